@@ -0,0 +1,105 @@
+package sharon
+
+import (
+	"encoding/binary"
+
+	"github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// errTruncated is returned when decoding runs past the end of the input.
+var errTruncated = errors.New("truncated binary input")
+
+// MarshalEntries encodes entries as an uvarint count followed by every key and value,
+// each prefixed with its uvarint length.
+func MarshalEntries(entries []Entry) []byte {
+	b := binary.AppendUvarint(nil, uint64(len(entries)))
+	for _, e := range entries {
+		b = appendChunk(b, e.Key)
+		b = appendChunk(b, e.Value)
+	}
+	return b
+}
+
+// UnmarshalEntries decodes entries encoded by MarshalEntries, keys and values are copied.
+func UnmarshalEntries(b []byte) ([]Entry, error) {
+	chunks, rest, err := readChunks(b, 2)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("trailing bytes after entries")
+	}
+	entries := make([]Entry, 0, len(chunks)/2)
+	for i := 0; i < len(chunks); i += 2 {
+		entries = append(entries, Entry{Key: chunks[i], Value: chunks[i+1]})
+	}
+	return entries, nil
+}
+
+// MarshalBinary encodes the state followed by the data in the MarshalEntries format,
+// with the count holding the number of data items.
+func (r *Reply) MarshalBinary() ([]byte, error) {
+	b := appendChunk(nil, []byte(r.State))
+	b = binary.AppendUvarint(b, uint64(len(r.Data)))
+	for _, d := range r.Data {
+		b = appendChunk(b, d)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a reply encoded by MarshalBinary.
+func (r *Reply) UnmarshalBinary(b []byte) error {
+	state, b, err := readChunk(b)
+	if err != nil {
+		return err
+	}
+	chunks, rest, err := readChunks(b, 1)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("trailing bytes after reply")
+	}
+	r.State = string(state)
+	r.Data = make([]BS, len(chunks))
+	for i, c := range chunks {
+		r.Data[i] = c
+	}
+	return nil
+}
+
+func appendChunk(b, chunk []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(chunk)))
+	return append(b, chunk...)
+}
+
+func readChunk(b []byte) (chunk, rest []byte, err error) {
+	n, sz := binary.Uvarint(b)
+	if sz <= 0 || n > uint64(len(b)-sz) {
+		return nil, nil, errTruncated
+	}
+	b = b[sz:]
+	return append([]byte{}, b[:n]...), b[n:], nil
+}
+
+// readChunks reads an uvarint count and count*per chunks following it.
+func readChunks(b []byte, per int) (chunks [][]byte, rest []byte, err error) {
+	count, sz := binary.Uvarint(b)
+	if sz <= 0 {
+		return nil, nil, errTruncated
+	}
+	b = b[sz:]
+	// every chunk takes at least one byte, which bounds a corrupt count
+	if count > uint64(len(b)/per) {
+		return nil, nil, errTruncated
+	}
+	chunks = make([][]byte, 0, int(count)*per)
+	for i := 0; i < int(count)*per; i++ {
+		var chunk []byte
+		if chunk, b, err = readChunk(b); err != nil {
+			return nil, nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, b, nil
+}
@@ -0,0 +1,66 @@
+package sharon_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestMarshalEntries(t *testing.T) {
+	entries := []sharon.Entry{
+		{Key: []byte("a"), Value: []byte("1")},
+		{Key: []byte{}, Value: []byte("empty key")},
+		{Key: []byte("empty value"), Value: []byte{}},
+		{Key: []byte{0x00, 0xff}, Value: bytes.Repeat([]byte{0x80}, 300)},
+	}
+	b := sharon.MarshalEntries(entries)
+	got, err := sharon.UnmarshalEntries(b)
+	if err != nil {
+		t.Fatalf("UnmarshalEntries failed: %v", err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("expected %d entries, got %d", len(entries), len(got))
+	}
+	for i := range entries {
+		if !bytes.Equal(got[i].Key, entries[i].Key) || !bytes.Equal(got[i].Value, entries[i].Value) {
+			t.Errorf("entry %d: expected %q=%q, got %q=%q", i, entries[i].Key, entries[i].Value, got[i].Key, got[i].Value)
+		}
+	}
+
+	for _, n := range []int{0, 1, len(b) / 2, len(b) - 1} {
+		if _, err := sharon.UnmarshalEntries(b[:n]); err == nil {
+			t.Errorf("expected error for input truncated to %d bytes", n)
+		}
+	}
+}
+
+func TestReplyMarshalBinary(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "wire"
+	_ = db.Hmset(name, []byte("k1"), []byte{0x00, 0x01}, []byte("k2"), []byte{})
+	rs := db.Hscan(name, nil, 10)
+	b, err := rs.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	got := new(sharon.Reply)
+	if err = got.UnmarshalBinary(b); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if got.State != rs.State || len(got.Data) != len(rs.Data) {
+		t.Fatalf("expected %s, got %s", rs.Debug(), got.Debug())
+	}
+	for i := range rs.Data {
+		if !bytes.Equal(got.Data[i], rs.Data[i]) {
+			t.Errorf("item %d: expected %q, got %q", i, rs.Data[i], got.Data[i])
+		}
+	}
+
+	if err = got.UnmarshalBinary(b[:len(b)-1]); err == nil {
+		t.Errorf("expected error for truncated reply")
+	}
+}
@@ -0,0 +1,132 @@
+package sharon
+
+import (
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/cache"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ErrNoCacheStats is returned by CacheStats when the DB was not opened with WithCacheStats.
+var ErrNoCacheStats = errors.New("block cache statistics unavailable")
+
+// WithCacheStats returns a copy of o, which may be nil, making Open count the block cache
+// hits and misses for CacheStats. The LRU block cache is kept, but counting serializes
+// its accesses on one mutex per DB.
+func WithCacheStats(o *opt.Options) *opt.Options {
+	oo := opt.Options{}
+	if o != nil {
+		oo = *o
+	}
+	oo.BlockCacher = statsCacher{}
+	return &oo
+}
+
+// statsCacher marks the options of WithCacheStats, Open replaces it with a countingCacher.
+// Used elsewhere it is a plain LRU block cacher.
+type statsCacher struct{}
+
+func (statsCacher) New(capacity int) cache.Cacher {
+	return cache.NewLRU(capacity)
+}
+
+// countingCacher wraps the LRU block cacher and counts lookups, a node that is
+// not yet tracked by the LRU is a miss, any other promotion is a hit.
+type countingCacher struct {
+	mu           sync.Mutex
+	c            cache.Cacher
+	hits, misses int64
+}
+
+// withCountingBlockCache returns a copy of o using a new counting LRU block cacher if o
+// was made by WithCacheStats, o is returned untouched otherwise.
+func withCountingBlockCache(o *opt.Options) (*opt.Options, *countingCacher) {
+	if o == nil {
+		return nil, nil
+	}
+	if _, ok := o.BlockCacher.(statsCacher); !ok {
+		return o, nil
+	}
+	oo := *o
+	cc := &countingCacher{}
+	oo.BlockCacher = &opt.CacherFunc{NewFunc: func(capacity int) cache.Cacher {
+		cc.c = cache.NewLRU(capacity)
+		return cc
+	}}
+	return &oo, cc
+}
+
+func (cc *countingCacher) Capacity() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.c.Capacity()
+}
+
+func (cc *countingCacher) SetCapacity(capacity int) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.c.SetCapacity(capacity)
+}
+
+func (cc *countingCacher) Promote(n *cache.Node) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if n.CacheData == nil {
+		cc.misses++
+	} else {
+		cc.hits++
+	}
+	cc.c.Promote(n)
+}
+
+func (cc *countingCacher) Ban(n *cache.Node) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.c.Ban(n)
+}
+
+func (cc *countingCacher) Evict(n *cache.Node) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.c.Evict(n)
+}
+
+func (cc *countingCacher) EvictNS(ns uint64) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.c.EvictNS(ns)
+}
+
+func (cc *countingCacher) EvictAll() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.c.EvictAll()
+}
+
+func (cc *countingCacher) Close() error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.c.Close()
+}
+
+// WarmHash reads every value of a hashmap so its table blocks are pulled into the block cache.
+func (db *DB) WarmHash(name string) error {
+	iter := db.newIterator(util.BytesPrefix(Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)), nil)
+	for iter.Next() {
+		_ = iter.Value()
+	}
+	iter.Release()
+	return iter.Error()
+}
+
+// CacheStats returns the block cache hits and misses since the DB was opened, see WithCacheStats.
+func (db *DB) CacheStats() (hits, misses int64, err error) {
+	if db.blockCache == nil {
+		return 0, 0, ErrNoCacheStats
+	}
+	db.blockCache.mu.Lock()
+	defer db.blockCache.mu.Unlock()
+	return db.blockCache.hits, db.blockCache.misses, nil
+}
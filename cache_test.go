@@ -0,0 +1,57 @@
+package sharon_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ehebe/sharon"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func TestWarmHash(t *testing.T) {
+	db := setupDB(t)
+	if _, _, err := db.CacheStats(); !errors.Is(err, sharon.ErrNoCacheStats) {
+		t.Errorf("expected ErrNoCacheStats without WithCacheStats, got %v", err)
+	}
+	_ = db.Close()
+	db, err := sharon.Open("testdb", sharon.WithCacheStats(nil))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	name := "hot"
+	kvs := make([][]byte, 0, 2000)
+	for i := 0; i < 1000; i++ {
+		kvs = append(kvs, sharon.Uint64ToBytes(uint64(i)), make([]byte, 100))
+	}
+	if err := db.Hmset(name, kvs...); err != nil {
+		t.Fatalf("Hmset failed: %v", err)
+	}
+	// move the data out of the memtable into table files
+	if err := db.CompactRange(util.Range{}); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+
+	if err := db.WarmHash(name); err != nil {
+		t.Fatalf("WarmHash failed: %v", err)
+	}
+	hits, misses, err := db.CacheStats()
+	if err != nil {
+		t.Fatalf("CacheStats failed: %v", err)
+	}
+	if misses == 0 {
+		t.Errorf("expected warmup to load blocks, got %d misses", misses)
+	}
+
+	if rs := db.Hscan(name, nil, 0); rs.KvLen() != 1000 {
+		t.Fatalf("expected 1000 entries, got %d", rs.KvLen())
+	}
+	hits2, misses2, _ := db.CacheStats()
+	if hits2 <= hits {
+		t.Errorf("expected more cache hits after warmup, got %d -> %d", hits, hits2)
+	}
+	if misses2 != misses {
+		t.Errorf("expected no new misses after warmup, got %d -> %d", misses, misses2)
+	}
+}
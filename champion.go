@@ -0,0 +1,148 @@
+package sharon
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The champion of a zset is its last member in score order, the highest score and the
+// highest key among ties. It is kept under metaPrefix+"zchamp"+splitChar+name as the
+// 8-byte score followed by the key. Zset, Zincr and Zdel update it in place, every other
+// write touching the members of a zset removes it in the same batch, and the next
+// Zchampion or update looks it up in the index again.
+
+// SetZsetChampion makes the zset writes keep the champion of every zset for Zchampion.
+// Zset, Zincr and Zdel cost a read of the champion, and an index lookup when the champion
+// itself is lowered or deleted, and they are serialized per zset. Every write also replays
+// its batch to find the zsets it touches. It must be set before the
+// DB is used concurrently, on a DB whose zsets were all written with it.
+func (db *DB) SetZsetChampion(enabled bool) {
+	db.zsetChampion = enabled
+}
+
+// Zchampion returns the member of a zset with the highest score, ok is false if the zset is empty.
+// Without a kept champion, e.g. before the first write with SetZsetChampion, it looks up the index.
+func (db *DB) Zchampion(name string) (key []byte, score uint64, ok bool) {
+	nameB := StringToBytesNoCopy(name)
+	val, err := db.Get(zchampKey(nameB), nil)
+	if err == errors.ErrNotFound {
+		val, err = db.zmax(nameB, nil)
+	}
+	if err != nil || val == nil {
+		return nil, 0, false
+	}
+	return val[scoreByteLen:], BytesToUint64(val[:scoreByteLen]), true
+}
+
+var zchampPrefix = Bconcat(metaPrefix, []byte("zchamp"), splitChar)
+
+func zchampKey(nameB []byte) []byte {
+	return Bconcat(zchampPrefix, nameB)
+}
+
+// lockChampions serializes the champion updates of the zsets named nameBs. Its stripes are
+// apart from those of lockKey, so writes may take them while holding key locks.
+func (db *DB) lockChampions(nameBs ...[]byte) func() {
+	champKeys := make([][]byte, len(nameBs))
+	for i, nameB := range nameBs {
+		champKeys[i] = zchampKey(nameB)
+	}
+	return lockStriped(&db.champLocks, champKeys)
+}
+
+// champTouches collects the zsets whose members a batch writes and the zsets whose champion
+// it writes.
+type champTouches struct {
+	members, champions map[string]bool
+}
+
+func (c *champTouches) touch(key []byte) {
+	if len(key) > 0 && (key[0] == zetScorePrefix[0] || key[0] == zetKeyPrefix[0]) {
+		if i := bytes.IndexByte(key[1:], splitChar[0]); i >= 0 {
+			c.members[string(key[1:1+i])] = true
+		}
+	} else if bytes.HasPrefix(key, zchampPrefix) {
+		c.champions[string(key[len(zchampPrefix):])] = true
+	}
+}
+
+func (c *champTouches) Put(key, _ []byte) { c.touch(key) }
+func (c *champTouches) Delete(key []byte) { c.touch(key) }
+
+// invalidateChampions stages removing the champion of every zset batch writes members of
+// without updating its champion, and locks them until the returned unlock is called.
+// Batches updating a champion come from callers already holding its lock.
+func (db *DB) invalidateChampions(batch *leveldb.Batch) (unlock func(), err error) {
+	c := champTouches{members: map[string]bool{}, champions: map[string]bool{}}
+	if err = batch.Replay(&c); err != nil {
+		return nil, err
+	}
+	var names [][]byte
+	for name := range c.members {
+		if !c.champions[name] {
+			names = append(names, []byte(name))
+		}
+	}
+	if len(names) == 0 {
+		return func() {}, nil
+	}
+	slices.SortFunc(names, bytes.Compare)
+	unlock = db.lockChampions(names...)
+	for _, nameB := range names {
+		batch.Delete(zchampKey(nameB))
+	}
+	return unlock, nil
+}
+
+// stageChampion stages the champion of a zset after key is set to score, or deleted
+// if score is nil, into batch. The caller must hold lockChampions of the zset.
+func (db *DB) stageChampion(batch *leveldb.Batch, nameB, key, score []byte) error {
+	champKey := zchampKey(nameB)
+	cur, err := db.Get(champKey, nil)
+	if err != nil && err != errors.ErrNotFound {
+		return err
+	}
+
+	var best []byte
+	switch {
+	case cur != nil && !bytes.Equal(cur[scoreByteLen:], key):
+		best = cur
+	case cur != nil && score != nil && bytes.Compare(score, cur[:scoreByteLen]) >= 0:
+		// the champion only went up
+	default:
+		if best, err = db.zmax(nameB, func(k []byte) bool { return bytes.Equal(k, key) }); err != nil {
+			return err
+		}
+	}
+	if score != nil {
+		if cand := Bconcat(score, key); best == nil || bytes.Compare(cand, best) > 0 {
+			best = cand
+		}
+	}
+	if best == nil {
+		batch.Delete(champKey)
+	} else {
+		batch.Put(champKey, best)
+	}
+	return nil
+}
+
+// zmax returns the score followed by the key of the last member of a zset in score order
+// that skip rejects, nil if there is none. A nil skip rejects nothing.
+func (db *DB) zmax(nameB []byte, skip func(key []byte) bool) ([]byte, error) {
+	prefix := Bconcat(zetKeyPrefix, nameB, splitChar)
+	iter := db.newIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	for ok := iter.Last(); ok; ok = iter.Prev() {
+		score := iter.Key()[len(prefix) : len(prefix)+scoreByteLen]
+		key := iter.Key()[len(prefix)+scoreByteLen+1:]
+		if skip == nil || !skip(key) {
+			return Bconcat(score, key), nil
+		}
+	}
+	return nil, iter.Error()
+}
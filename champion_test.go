@@ -0,0 +1,85 @@
+package sharon_test
+
+import (
+	"testing"
+)
+
+func TestZchampion(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	db.SetZsetChampion(true)
+
+	name := "arena"
+	check := func(wantKey string, wantScore uint64) {
+		t.Helper()
+		key, score, ok := db.Zchampion(name)
+		if !ok || string(key) != wantKey || score != wantScore {
+			t.Errorf("expected champion %s=%d, got %s=%d (ok=%v)", wantKey, wantScore, key, score, ok)
+		}
+	}
+
+	if _, _, ok := db.Zchampion(name); ok {
+		t.Errorf("expected no champion in an empty zset")
+	}
+	_ = db.Zset(name, []byte("ann"), 10)
+	check("ann", 10)
+	_ = db.Zset(name, []byte("bob"), 30)
+	_ = db.Zset(name, []byte("cid"), 20)
+	check("bob", 30)
+
+	// an increment takes over, the champion going up stays
+	_, _ = db.Zincr(name, []byte("cid"), 15)
+	check("cid", 35)
+	_, _ = db.Zincr(name, []byte("cid"), 5)
+	check("cid", 40)
+
+	// lowering or deleting the champion falls back to the index
+	_ = db.Zset(name, []byte("cid"), 5)
+	check("bob", 30)
+	_ = db.Zdel(name, []byte("bob"))
+	check("ann", 10)
+
+	// ties go to the highest key, like the end of the score index
+	_ = db.Zset(name, []byte("dan"), 10)
+	check("dan", 10)
+
+	_ = db.ZdelBucket(name)
+	if _, _, ok := db.Zchampion(name); ok {
+		t.Errorf("expected no champion after ZdelBucket")
+	}
+}
+
+func TestZchampionOtherWrites(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	db.SetZsetChampion(true)
+
+	check := func(name, wantKey string, wantScore uint64) {
+		t.Helper()
+		key, score, ok := db.Zchampion(name)
+		if !ok || string(key) != wantKey || score != wantScore {
+			t.Errorf("expected champion %s=%d of %s, got %s=%d (ok=%v)", wantKey, wantScore, name, key, score, ok)
+		}
+	}
+
+	name := "league"
+	for i, k := range []string{"a", "b", "c", "d"} {
+		_ = db.Zset(name, []byte(k), uint64(i+1)*10)
+	}
+	check(name, "d", 40)
+
+	db.ZpopMaxN(name, 1)
+	check(name, "c", 30)
+	_ = db.Zmdel(name, [][]byte{[]byte("c")})
+	check(name, "b", 20)
+	_ = db.Zswap(name, []byte("a"), []byte("b"))
+	check(name, "a", 20)
+
+	if err := db.Zrename(name, "cup"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := db.Zchampion(name); ok {
+		t.Errorf("expected no champion left under the old name")
+	}
+	check("cup", "a", 20)
+}
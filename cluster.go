@@ -0,0 +1,177 @@
+package sharon
+
+import (
+	"bytes"
+	"hash/fnv"
+
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Cluster spreads buckets over several DBs, routing every hashmap and zset by its name so a
+// bucket lives on a single shard. Names are placed with a jump consistent hash, growing the
+// cluster by one shard moves about 1/n of the buckets, all of them to the new shard.
+type Cluster struct {
+	shards []*DB
+}
+
+// NewCluster returns a cluster over shards, their order decides the routing and must be kept.
+func NewCluster(shards ...*DB) (*Cluster, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("cluster needs at least one shard")
+	}
+	return &Cluster{shards: shards}, nil
+}
+
+// Shard returns the index of the shard holding the bucket name.
+func (c *Cluster) Shard(name string) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return jumpHash(h.Sum64(), len(c.shards))
+}
+
+// jumpHash is the jump consistent hash of Lamping and Veach.
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// DB returns the shard holding the bucket name, for the methods the cluster does not wrap.
+func (c *Cluster) DB(name string) *DB {
+	return c.shards[c.Shard(name)]
+}
+
+// Close closes every shard, it returns the first error.
+func (c *Cluster) Close() error {
+	var first error
+	for _, db := range c.shards {
+		if err := db.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Hset set the value of the key of a hashmap on its shard.
+func (c *Cluster) Hset(name string, key, val []byte) error {
+	return c.DB(name).Hset(name, key, val)
+}
+
+// Hget get the value of the key of a hashmap from its shard.
+func (c *Cluster) Hget(name string, key []byte) *Reply {
+	return c.DB(name).Hget(name, key)
+}
+
+// Hdel delete the key of a hashmap on its shard.
+func (c *Cluster) Hdel(name string, key []byte) error {
+	return c.DB(name).Hdel(name, key)
+}
+
+// Hscan list key-value pairs of a hashmap from its shard.
+func (c *Cluster) Hscan(name string, keyStart []byte, limit int) *Reply {
+	return c.DB(name).Hscan(name, keyStart, limit)
+}
+
+// Zset set the score of the key of a zset on its shard.
+func (c *Cluster) Zset(name string, key []byte, val uint64) error {
+	return c.DB(name).Zset(name, key, val)
+}
+
+// Zget get the score of the key of a zset from its shard.
+func (c *Cluster) Zget(name string, key []byte) uint64 {
+	return c.DB(name).Zget(name, key)
+}
+
+// Zincr increment the score of the key of a zset on its shard.
+func (c *Cluster) Zincr(name string, key []byte, step int64) (uint64, error) {
+	return c.DB(name).Zincr(name, key, step)
+}
+
+// Zdel delete the key of a zset on its shard.
+func (c *Cluster) Zdel(name string, key []byte) error {
+	return c.DB(name).Zdel(name, key)
+}
+
+// Zscan list key-score pairs of a zset from its shard.
+func (c *Cluster) Zscan(name string, keyStart, scoreStart []byte, limit int) *Reply {
+	return c.DB(name).Zscan(name, keyStart, scoreStart, limit)
+}
+
+// HscanAll is HscanMulti across shards: it lists key-value pairs after keyStart of the union
+// of several hashmaps wherever they live, merged in key order. A key present in more than one
+// hashmap is returned once, with the value of the first listed hashmap holding it.
+// The reply is capped by SetMaxReplyBytes of the first shard.
+func (c *Cluster) HscanAll(names []string, keyStart []byte, limit int) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	// the iterators of a shard take their scan slots together, shard after shard in a
+	// fixed order, so concurrent calls never wait for each other while holding slots
+	iters := make([]*HashIterator, len(names))
+	for s, db := range c.shards {
+		var idx []int
+		var prefixes [][]byte
+		var ranges []*util.Range
+		for i, name := range names {
+			if c.Shard(name) == s {
+				prefix := db.hashIteratorPrefix(name)
+				idx = append(idx, i)
+				prefixes = append(prefixes, prefix)
+				ranges = append(ranges, util.BytesPrefix(prefix))
+			}
+		}
+		for j, iter := range db.newIterators(ranges, nil) {
+			iters[idx[j]] = db.newHashIterator(prefixes[j], iter)
+			defer iter.Release()
+		}
+	}
+	valid := make([]bool, len(names))
+	for i, it := range iters {
+		valid[i] = it.Seek(keyStart)
+		if valid[i] && len(keyStart) > 0 && bytes.Equal(it.Key(), keyStart) {
+			valid[i] = it.Next()
+		}
+	}
+
+	n, size := 0, 0
+	for n == 0 || n != limit {
+		min := -1
+		for i, it := range iters {
+			if valid[i] && (min < 0 || bytes.Compare(it.Key(), iters[min].Key()) < 0) {
+				min = i
+			}
+		}
+		if min < 0 {
+			break
+		}
+		minKey := append([]byte{}, iters[min].Key()...)
+		r.Data = append(r.Data, minKey, append([]byte{}, iters[min].Value()...))
+		if c.shards[0].replyFull(r, &size) {
+			return r
+		}
+		n++
+
+		for i, it := range iters {
+			if valid[i] && bytes.Equal(it.Key(), minKey) {
+				valid[i] = it.Next()
+			}
+		}
+	}
+	for _, it := range iters {
+		if err := it.Error(); err != nil {
+			r.State = err.Error()
+			r.Data = []BS{}
+			return r
+		}
+	}
+	if n > 0 {
+		r.State = replyOK
+	}
+	return r
+}
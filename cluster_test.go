@@ -0,0 +1,87 @@
+package sharon_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestCluster(t *testing.T) {
+	dir := t.TempDir()
+	var shards []*sharon.DB
+	for i := 0; i < 3; i++ {
+		db, err := sharon.Open(filepath.Join(dir, fmt.Sprint(i)), nil)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		shards = append(shards, db)
+	}
+	c, err := sharon.NewCluster(shards...)
+	if err != nil {
+		t.Fatalf("NewCluster failed: %v", err)
+	}
+	defer c.Close()
+
+	// the routing is stable and only depends on the name
+	used := map[int]bool{}
+	var names []string
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("bucket%d", i)
+		s := c.Shard(name)
+		if s < 0 || s >= 3 || s != c.Shard(name) {
+			t.Fatalf("unstable or out of range shard %d for %s", s, name)
+		}
+		used[s] = true
+		names = append(names, name)
+	}
+	if len(used) != 3 {
+		t.Errorf("expected buckets on every shard, got %v", used)
+	}
+
+	for i, name := range names {
+		_ = c.Hset(name, []byte(fmt.Sprintf("k%02d", i)), []byte(name))
+		_ = c.Hset(name, []byte("shared"), []byte(name))
+		if !shards[c.Shard(name)].HhasKey(name, []byte("shared")) {
+			t.Errorf("expected %s on shard %d", name, c.Shard(name))
+		}
+		for s, db := range shards {
+			if s != c.Shard(name) && db.HhasKey(name, []byte("shared")) {
+				t.Errorf("expected %s only on shard %d, found on %d", name, c.Shard(name), s)
+			}
+		}
+	}
+	if got := c.Hget("bucket3", []byte("k03")).String(); got != "bucket3" {
+		t.Errorf("expected bucket3, got %q", got)
+	}
+
+	rs := c.HscanAll(names, nil, 0)
+	var keys []string
+	rs.KvEach(func(key, _ sharon.BS) {
+		keys = append(keys, key.String())
+	})
+	if len(keys) != 21 || !slices.IsSorted(keys) {
+		t.Errorf("expected 21 merged keys in order, got %v", keys)
+	}
+	if got := rs.Dict()["shared"]; string(got) != "bucket0" {
+		t.Errorf("expected the first listed bucket to win, got %q", got)
+	}
+	if got := c.HscanAll(names, []byte("k18"), 2).KvLen(); got != 2 {
+		t.Errorf("expected a limited page of 2, got %d", got)
+	}
+	shards[0].SetMaxReplyBytes(50)
+	if rs = c.HscanAll(names, nil, 0); rs.OK() || rs.KvLen() != 5 {
+		t.Errorf("expected the cap of the first shard to stop at 5 entries, got %d (%s)", rs.KvLen(), rs.State)
+	}
+	shards[0].SetMaxReplyBytes(0)
+
+	// adding a shard only moves buckets to the new one
+	grown, _ := sharon.NewCluster(append(slices.Clone(shards), shards[0])...)
+	for _, name := range names {
+		if s := grown.Shard(name); s != 3 && s != c.Shard(name) {
+			t.Errorf("%s moved from shard %d to %d", name, c.Shard(name), s)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package sharon
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// gzipMagic is the header every gzip stream starts with, values without it
+// are treated as legacy plaintext by GzipCodec.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+type (
+	// ValueCodec transforms hashmap values on their way to and from leveldb.
+	// Keys are never encoded so ordering and scans keep working.
+	ValueCodec interface {
+		Encode(val []byte) []byte
+		Decode(val []byte) ([]byte, error)
+	}
+
+	// GzipCodec compresses values with gzip.
+	GzipCodec struct{}
+
+	aesGCMCodec struct {
+		aead cipher.AEAD
+	}
+)
+
+// SetValueCodec sets the codec applied to all hashmap value reads and writes,
+// nil disables it. It must be set before the DB is used concurrently.
+func (db *DB) SetValueCodec(c ValueCodec) {
+	db.codec = c
+}
+
+func (db *DB) encodeValue(val []byte) []byte {
+	if db.codec == nil {
+		return val
+	}
+	return db.codec.Encode(val)
+}
+
+func (db *DB) decodeValue(val []byte) ([]byte, error) {
+	if db.codec == nil {
+		return val, nil
+	}
+	return db.codec.Decode(val)
+}
+
+// Encode compresses val with the default gzip level.
+func (GzipCodec) Encode(val []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write(val)
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+// Decode decompresses val, values without the gzip magic bytes are returned as is.
+func (GzipCodec) Decode(val []byte) ([]byte, error) {
+	if !bytes.HasPrefix(val, gzipMagic) {
+		return val, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(val))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// AESGCMCodec returns a codec encrypting values with AES-GCM, the random nonce
+// is prepended to the stored ciphertext. It panics if key is not 16, 24 or 32 bytes.
+func AESGCMCodec(key []byte) ValueCodec {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &aesGCMCodec{aead: aead}
+}
+
+// Encode encrypts val with a fresh random nonce.
+func (c *aesGCMCodec) Encode(val []byte) []byte {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(val)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return c.aead.Seal(nonce, nonce, val, nil)
+}
+
+// Decode decrypts val, it fails if val was not sealed with the same key.
+func (c *aesGCMCodec) Decode(val []byte) ([]byte, error) {
+	n := c.aead.NonceSize()
+	if len(val) < n {
+		return nil, errors.New("ciphertext too short")
+	}
+	return c.aead.Open(nil, val[:n], val[n:], nil)
+}
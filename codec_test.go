@@ -0,0 +1,85 @@
+package sharon_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestGzipCodec(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "blobs"
+	key := []byte("doc")
+	value := bytes.Repeat([]byte(`{"field":"value","n":1},`), 64)
+
+	db.SetValueCodec(sharon.GzipCodec{})
+	if err := db.Hset(name, key, value); err != nil {
+		t.Fatalf("Hset failed: %v", err)
+	}
+
+	rs := db.Hget(name, key)
+	if !rs.OK() {
+		t.Fatalf("Hget failed: %s", rs.State)
+	}
+	if !bytes.Equal(rs.Bytes(), value) {
+		t.Errorf("expected original value back, got %q", rs.Bytes())
+	}
+
+	raw, err := db.DB.Get(sharon.Bconcat([]byte{30}, []byte(name), []byte{28}, key), nil)
+	if err != nil {
+		t.Fatalf("raw get failed: %v", err)
+	}
+	if bytes.Equal(raw, value) || len(raw) >= len(value) {
+		t.Errorf("expected compressed bytes on disk, got %d bytes", len(raw))
+	}
+
+	legacy := []byte("plain")
+	if err := db.Put(sharon.Bconcat([]byte{30}, []byte(name), []byte{28}, []byte("old")), legacy, nil); err != nil {
+		t.Fatalf("raw put failed: %v", err)
+	}
+	if got := db.Hget(name, []byte("old")).Bytes(); !bytes.Equal(got, legacy) {
+		t.Errorf("expected legacy value %q, got %q", legacy, got)
+	}
+}
+
+func TestAESGCMCodec(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "secrets"
+	key := []byte("token")
+	value := []byte("top secret")
+
+	db.SetValueCodec(sharon.AESGCMCodec(bytes.Repeat([]byte{1}, 32)))
+	if err := db.Hset(name, key, value); err != nil {
+		t.Fatalf("Hset failed: %v", err)
+	}
+
+	raw, err := db.DB.Get(sharon.Bconcat([]byte{30}, []byte(name), []byte{28}, key), nil)
+	if err != nil {
+		t.Fatalf("raw get failed: %v", err)
+	}
+	if bytes.Contains(raw, value) {
+		t.Errorf("expected ciphertext on disk, got %q", raw)
+	}
+
+	rs := db.Hget(name, key)
+	if !rs.OK() {
+		t.Fatalf("Hget failed: %s", rs.State)
+	}
+	if !bytes.Equal(rs.Bytes(), value) {
+		t.Errorf("expected %q, got %q", value, rs.Bytes())
+	}
+
+	db.SetValueCodec(sharon.AESGCMCodec(bytes.Repeat([]byte{2}, 32)))
+	rs = db.Hget(name, key)
+	if rs.OK() || rs.NotFound() {
+		t.Errorf("expected decryption error, got %s", rs.State)
+	}
+	if len(rs.Data) != 0 {
+		t.Errorf("expected no data on decryption failure, got %q", rs.Data)
+	}
+}
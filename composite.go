@@ -0,0 +1,54 @@
+package sharon
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// compositeScoreLen is the length of a composite score, primary then secondary big endian.
+const compositeScoreLen = 2 * scoreByteLen
+
+// A composite zset orders its members by a primary score and breaks ties with a secondary
+// one, e.g. the negated time the primary score was reached. Its members must only be
+// written and scanned with the composite methods, their scores are 16 bytes long.
+
+// CompositeToBytes encodes a composite score, e.g. as the scoreStart of ZscanComposite.
+func CompositeToBytes(primary, secondary uint64) []byte {
+	return Bconcat(Uint64ToBytes(primary), Uint64ToBytes(secondary))
+}
+
+// BytesToComposite decodes a composite score returned by ZscanComposite.
+func BytesToComposite(b []byte) (primary, secondary uint64) {
+	if len(b) != compositeScoreLen {
+		return 0, 0
+	}
+	return BytesToUint64(b[:scoreByteLen]), BytesToUint64(b[scoreByteLen:])
+}
+
+// ZsetComposite set the composite score of the key of a composite zset.
+func (db *DB) ZsetComposite(name string, key []byte, primary, secondary uint64) error {
+	nameB := StringToBytesNoCopy(name)
+	defer db.lockKey(Bconcat(zetScorePrefix, nameB, splitChar, key))()
+
+	batch := new(leveldb.Batch)
+	if _, err := db.stageZset(batch, nameB, key, CompositeToBytes(primary, secondary)); err != nil {
+		return err
+	}
+	return db.write(batch)
+}
+
+// ZgetComposite get the composite score of the key of a composite zset.
+func (db *DB) ZgetComposite(name string, key []byte) (primary, secondary uint64, err error) {
+	val, err := db.Get(Bconcat(zetScorePrefix, StringToBytesNoCopy(name), splitChar, key), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	primary, secondary = BytesToComposite(val)
+	return primary, secondary, nil
+}
+
+// ZscanComposite list key-score pairs of a composite zset like Zscan, ordered by primary then
+// secondary score. scoreStart must be produced with CompositeToBytes, the returned scores
+// are decoded with BytesToComposite.
+func (db *DB) ZscanComposite(name string, keyStart, scoreStart []byte, limit int) *Reply {
+	return db.zscan(name, keyStart, scoreStart, limit, compositeScoreLen)
+}
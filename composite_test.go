@@ -0,0 +1,52 @@
+package sharon_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestZsetComposite(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "board"
+	// ties on points are broken by who got there first, so the secondary is the negated time
+	reached := func(ts uint64) uint64 { return math.MaxUint64 - ts }
+	_ = db.ZsetComposite(name, []byte("late"), 100, reached(300))
+	_ = db.ZsetComposite(name, []byte("early"), 100, reached(100))
+	_ = db.ZsetComposite(name, []byte("low"), 50, reached(50))
+	_ = db.ZsetComposite(name, []byte("high"), 200, reached(400))
+	_ = db.ZsetComposite(name, []byte("low"), 150, reached(500))
+
+	var keys []string
+	db.ZscanComposite(name, nil, nil, 0).KvEach(func(key, score sharon.BS) {
+		keys = append(keys, key.String())
+	})
+	want := []string{"late", "early", "low", "high"}
+	if len(keys) != len(want) {
+		t.Fatalf("expected %v, got %v", want, keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, keys)
+		}
+	}
+
+	primary, secondary, err := db.ZgetComposite(name, []byte("low"))
+	if err != nil || primary != 150 || secondary != reached(500) {
+		t.Errorf("expected 150/%d, got %d/%d (%v)", reached(500), primary, secondary, err)
+	}
+	if _, _, err = db.ZgetComposite(name, []byte("missing")); err == nil {
+		t.Errorf("expected not found error")
+	}
+
+	rs := db.ZscanComposite(name, []byte("early"), sharon.CompositeToBytes(100, reached(100)), 1)
+	if rs.KvLen() != 1 || rs.Data[0].String() != "low" {
+		t.Fatalf("expected low after early, got %s", rs.Debug())
+	}
+	if p, s := sharon.BytesToComposite(rs.Data[1]); p != 150 || s != reached(500) {
+		t.Errorf("expected decoded score 150/%d, got %d/%d", reached(500), p, s)
+	}
+}
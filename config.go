@@ -0,0 +1,59 @@
+package sharon
+
+import (
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+const (
+	defaultBloomBitsPerKey = 10
+	defaultBlockCacheMB    = 8
+	defaultWriteBufferMB   = 4
+)
+
+// Config holds the common leveldb tuning knobs, zero values pick the defaults.
+type Config struct {
+	// BloomBitsPerKey sizes the bloom filter of table files, 0 means 10 and a negative value disables it.
+	BloomBitsPerKey int
+	// BlockCacheMB is the block cache capacity in MiB, 0 means 8.
+	BlockCacheMB int
+	// WriteBufferMB is the memtable size in MiB, 0 means 4.
+	WriteBufferMB int
+	// ReadOnly opens the DB in read-only mode.
+	ReadOnly bool
+	// DisableCompression turns off the snappy compression of table blocks, which is leveldb's default.
+	DisableCompression bool
+	// CacheStats counts the block cache hits and misses, see WithCacheStats.
+	CacheStats bool
+}
+
+// Options translates the config into leveldb options.
+func (c Config) Options() *opt.Options {
+	o := &opt.Options{
+		BlockCacheCapacity: orDefault(c.BlockCacheMB, defaultBlockCacheMB) * opt.MiB,
+		WriteBuffer:        orDefault(c.WriteBufferMB, defaultWriteBufferMB) * opt.MiB,
+		ReadOnly:           c.ReadOnly,
+	}
+	if bits := orDefault(c.BloomBitsPerKey, defaultBloomBitsPerKey); bits > 0 {
+		o.Filter = filter.NewBloomFilter(bits)
+	}
+	if c.DisableCompression {
+		o.Compression = opt.NoCompression
+	}
+	if c.CacheStats {
+		o = WithCacheStats(o)
+	}
+	return o
+}
+
+// OpenConfig creates/opens a DB at specified path with the options of cfg.
+func OpenConfig(path string, cfg Config) (*DB, error) {
+	return Open(path, cfg.Options())
+}
+
+func orDefault(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
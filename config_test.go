@@ -0,0 +1,57 @@
+package sharon_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ehebe/sharon"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+func TestConfigOptions(t *testing.T) {
+	o := sharon.Config{}.Options()
+	if o.Filter == nil || o.Filter.Name() != "leveldb.BuiltinBloomFilter" {
+		t.Errorf("expected default bloom filter, got %v", o.Filter)
+	}
+	if o.BlockCacheCapacity != 8*opt.MiB || o.WriteBuffer != 4*opt.MiB {
+		t.Errorf("unexpected default sizes %d, %d", o.BlockCacheCapacity, o.WriteBuffer)
+	}
+	if o.GetCompression() != opt.SnappyCompression {
+		t.Errorf("expected leveldb's snappy compression by default")
+	}
+
+	o = sharon.Config{BloomBitsPerKey: -1, BlockCacheMB: 32, DisableCompression: true}.Options()
+	if o.Filter != nil {
+		t.Errorf("expected bloom filter to be disabled")
+	}
+	if o.BlockCacheCapacity != 32*opt.MiB || o.Compression != opt.NoCompression {
+		t.Errorf("unexpected options %+v", o)
+	}
+}
+
+func TestOpenConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cfg")
+	db, err := sharon.OpenConfig(path, sharon.Config{BloomBitsPerKey: 12, DisableCompression: true})
+	if err != nil {
+		t.Fatalf("OpenConfig failed: %v", err)
+	}
+	if err = db.Hset("cfg", []byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Hset failed: %v", err)
+	}
+	if got := db.Hget("cfg", []byte("k")).String(); got != "v" {
+		t.Errorf("expected v, got %q", got)
+	}
+	_ = db.Close()
+
+	db, err = sharon.OpenConfig(path, sharon.Config{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("read-only OpenConfig failed: %v", err)
+	}
+	defer db.Close()
+	if got := db.Hget("cfg", []byte("k")).String(); got != "v" {
+		t.Errorf("expected v after reopen, got %q", got)
+	}
+	if err = db.Hset("cfg", []byte("k"), []byte("w")); err == nil {
+		t.Errorf("expected write to fail on a read-only DB")
+	}
+}
@@ -0,0 +1,163 @@
+package sharon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// loadChunk is the number of records LoadPrefix writes per batch.
+const loadChunk = 1000
+
+// DumpPrefix writes every raw key under prefix with its stored value to w, as a sequence
+// of uvarint length-prefixed key and value pairs. prefix selects e.g. the keys of one
+// hashmap or the type byte of all zsets, the deadlines of the keys are not included.
+func (db *DB) DumpPrefix(prefix []byte, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var buf []byte
+	iter := db.newIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		buf = appendChunk(buf[:0], iter.Key())
+		buf = appendChunk(buf, iter.Value())
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// LoadPrefix merges a dump written by DumpPrefix into the DB, overwriting existing keys.
+// It fails before writing a record whose key is not under prefix, nil accepts any key.
+// Records are written in batches, so a failed load may be partially applied. An overwritten
+// hashmap key loses its deadline unless the dump holds one for it.
+func (db *DB) LoadPrefix(prefix []byte, r io.Reader) error {
+	br := bufio.NewReader(r)
+	batch := new(leveldb.Batch)
+	loadedTTL := map[string]bool{}
+	for {
+		key, err := readDumpChunk(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		val, err := readDumpChunk(br)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(key, prefix) {
+			return errors.New("dump key outside of prefix")
+		}
+		if bytes.HasPrefix(key, ttlPrefix) {
+			db.ttlUsed.Store(true)
+			loadedTTL[string(key[len(ttlPrefix):])] = true
+		}
+		batch.Put(key, val)
+		if len(key) > 0 && key[0] == hashPrefix[0] && !loadedTTL[string(key)] {
+			db.clearTTL(batch, key)
+		}
+		if batch.Len() >= loadChunk {
+			if err = db.write(batch); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	return db.write(batch)
+}
+
+// AppendZsetRecord appends a record read by ZsetStream to b: the uvarint length-prefixed
+// member followed by its 8-byte big endian score.
+func AppendZsetRecord(b, key []byte, score uint64) []byte {
+	return append(appendChunk(b, key), Uint64ToBytes(score)...)
+}
+
+// ZsetStream set the scores of a zset from the records written by AppendZsetRecord read
+// from r, in batches of bounded size. It returns the number of records written, a failed
+// stream may be partially applied. If a member repeats, its last record wins.
+func (db *DB) ZsetStream(name string, r io.Reader) (count int64, err error) {
+	nameB := StringToBytesNoCopy(name)
+	br := bufio.NewReader(r)
+	batch := new(leveldb.Batch)
+	staged := make(map[string]bool, loadChunk)
+	flush := func() error {
+		if err := db.write(batch); err != nil {
+			return err
+		}
+		count += int64(len(staged))
+		batch.Reset()
+		clear(staged)
+		return nil
+	}
+	score := make([]byte, scoreByteLen)
+	for {
+		key, err := readDumpChunk(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+		if _, err = io.ReadFull(br, score); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return count, err
+		}
+		// the score index of a member staged in batch is not visible to stageZset yet
+		if staged[string(key)] {
+			if err = flush(); err != nil {
+				return count, err
+			}
+		}
+		if _, err = db.stageZset(batch, nameB, key, score); err != nil {
+			return count, err
+		}
+		staged[string(key)] = true
+		if len(staged) == loadChunk {
+			if err = flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if len(staged) == 0 {
+		return count, nil
+	}
+	return count, flush()
+}
+
+// readDumpChunk reads one length-prefixed chunk, io.EOF only at a chunk boundary.
+func readDumpChunk(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	// guards the allocation against a corrupt length
+	if n > 1<<30 {
+		return nil, errors.New("dump chunk too large")
+	}
+	chunk := make([]byte, n)
+	if _, err = io.ReadFull(br, chunk); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return chunk, nil
+}
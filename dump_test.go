@@ -0,0 +1,128 @@
+package sharon_test
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestDumpLoadPrefix(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	_ = db.Hmset("users", []byte("alice"), []byte("1"), []byte("bob"), []byte{})
+	_ = db.Hmset("users2", []byte("carol"), []byte("3"))
+	_ = db.Hset("sessions", []byte("s1"), []byte("x"))
+	_ = db.Zset("users", []byte("alice"), 5)
+
+	prefix := sharon.Bconcat([]byte{30}, []byte("users"), []byte{28})
+	var buf bytes.Buffer
+	if err := db.DumpPrefix(prefix, &buf); err != nil {
+		t.Fatalf("DumpPrefix failed: %v", err)
+	}
+	dump := buf.Bytes()
+
+	target, err := sharon.Open(filepath.Join(t.TempDir(), "target"), nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer target.Close()
+	_ = target.Hset("users", []byte("dave"), []byte("4"))
+
+	if err = target.LoadPrefix(prefix, bytes.NewReader(dump)); err != nil {
+		t.Fatalf("LoadPrefix failed: %v", err)
+	}
+	var got []string
+	target.Hscan("users", nil, 0).KvEach(func(key, value sharon.BS) {
+		got = append(got, key.String()+"="+value.String())
+	})
+	want := []string{"alice=1", "bob=", "dave=4"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, got)
+			break
+		}
+	}
+	for _, name := range []string{"users2", "sessions"} {
+		if rs := target.Hscan(name, nil, 0); rs.OK() {
+			t.Errorf("expected %s not to be dumped, got %s", name, rs.Debug())
+		}
+	}
+	if rs := target.Zscan("users", nil, nil, 0); rs.OK() {
+		t.Errorf("expected zset not to be dumped, got %s", rs.Debug())
+	}
+
+	// an overwritten key must not keep the deadline of the old one
+	_ = target.Hset("users", []byte("alice"), []byte("old"))
+	_ = target.Hexpire("users", []byte("alice"), time.Hour)
+	if err = target.LoadPrefix(prefix, bytes.NewReader(dump)); err != nil {
+		t.Fatalf("LoadPrefix failed: %v", err)
+	}
+	if list, _ := target.HttlList("users", 0); len(list) != 0 {
+		t.Errorf("expected the loaded key to drop the old deadline, got %v", list)
+	}
+
+	// a deadline in the dump is kept
+	_ = db.Hexpire("users", []byte("bob"), time.Hour)
+	buf.Reset()
+	if err = db.DumpPrefix(nil, &buf); err != nil {
+		t.Fatalf("DumpPrefix failed: %v", err)
+	}
+	if err = target.LoadPrefix(nil, &buf); err != nil {
+		t.Fatalf("LoadPrefix failed: %v", err)
+	}
+	if list, _ := target.HttlList("users", 0); len(list) != 1 || list[0].Key.String() != "bob" {
+		t.Errorf("expected the dumped deadline of bob, got %v", list)
+	}
+
+	if err = target.LoadPrefix([]byte{29}, bytes.NewReader(dump)); err == nil {
+		t.Errorf("expected keys outside the prefix to be refused")
+	}
+	if err = target.LoadPrefix(nil, bytes.NewReader(dump[:len(dump)-1])); err == nil {
+		t.Errorf("expected truncated dump to fail")
+	}
+}
+
+func TestZsetStream(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	const members = 5000
+	for i := 0; i < members; i++ {
+		buf.Write(sharon.AppendZsetRecord(nil, []byte(fmt.Sprintf("m%05d", i)), uint64(i*3+1)))
+	}
+	// a repeated member keeps its last score
+	buf.Write(sharon.AppendZsetRecord(nil, []byte("m00001"), 7))
+
+	count, err := db.ZsetStream("board", &buf)
+	if err != nil {
+		t.Fatalf("ZsetStream failed: %v", err)
+	}
+	if count != members+1 {
+		t.Errorf("expected %d records, got %d", members+1, count)
+	}
+	for _, i := range []int{0, 2, 999, 1000, 4999} {
+		if got := db.Zget("board", []byte(fmt.Sprintf("m%05d", i))); got != uint64(i*3+1) {
+			t.Errorf("member %d: expected %d, got %d", i, i*3+1, got)
+		}
+	}
+	if got := db.Zget("board", []byte("m00001")); got != 7 {
+		t.Errorf("expected last score 7, got %d", got)
+	}
+	if got := db.Zscan("board", nil, nil, 0).KvLen(); got != members {
+		t.Errorf("expected %d members in the score index, got %d", members, got)
+	}
+
+	truncated := sharon.AppendZsetRecord(nil, []byte("x"), 1)
+	if _, err := db.ZsetStream("board", bytes.NewReader(truncated[:len(truncated)-2])); err == nil {
+		t.Errorf("expected error on truncated record")
+	}
+}
@@ -0,0 +1,16 @@
+package sharon
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// SetWriteFunc replaces the leveldb write used by all writes, nil restores it.
+func (db *DB) SetWriteFunc(fn func(batch *leveldb.Batch) error) {
+	db.writeFn = fn
+}
+
+// SetReadFunc replaces the leveldb get used by hashmap point reads, nil restores it.
+func (db *DB) SetReadFunc(fn func(key []byte, ro *opt.ReadOptions) ([]byte, error)) {
+	db.readFn = fn
+}
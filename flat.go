@@ -0,0 +1,79 @@
+package sharon
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// The flat keyspace stores values under flatPrefix+key without codec, deadlines use
+// the same ttlPrefix meta keys as hashmaps.
+
+// Set set the value of key of the flat keyspace, removing its deadline.
+func (db *DB) Set(key, val []byte) error {
+	realKey := Bconcat(flatPrefix, key)
+	batch := new(leveldb.Batch)
+	batch.Put(realKey, val)
+	db.clearTTL(batch, realKey)
+	return db.write(batch)
+}
+
+// SetEx set the value of key of the flat keyspace, expiring it after ttl.
+func (db *DB) SetEx(key, val []byte, ttl time.Duration) error {
+	realKey := Bconcat(flatPrefix, key)
+	db.ttlUsed.Store(true)
+	batch := new(leveldb.Batch)
+	batch.Put(realKey, val)
+	batch.Put(Bconcat(ttlPrefix, realKey), Uint64ToBytes(deadlineNano(time.Now().Add(ttl))))
+	return db.write(batch)
+}
+
+// Kget get the value of key of the flat keyspace, expired keys are not found.
+func (db *DB) Kget(key []byte) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	realKey := Bconcat(flatPrefix, key)
+	val, err := db.Get(realKey, nil)
+	if err == nil {
+		var expired bool
+		if expired, err = db.expired(realKey); expired {
+			err = errors.ErrNotFound
+		}
+	}
+	if err != nil {
+		r.State = err.Error()
+		return r
+	}
+	r.State = replyOK
+	r.Data = append(r.Data, val)
+	return r
+}
+
+// Ttl returns the time left before key of the flat keyspace expires, -1 if it has no deadline.
+// It returns ErrNotFound if the key does not exist or expired.
+func (db *DB) Ttl(key []byte) (time.Duration, error) {
+	realKey := Bconcat(flatPrefix, key)
+	has, err := db.hhas(realKey)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		return 0, errors.ErrNotFound
+	}
+	val, err := db.Get(Bconcat(ttlPrefix, realKey), nil)
+	if err == errors.ErrNotFound {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	// the key may expire between the check above and now
+	left := time.Until(time.Unix(0, int64(BytesToUint64(val))))
+	if left < 0 {
+		return 0, nil
+	}
+	return left, nil
+}
@@ -0,0 +1,80 @@
+package sharon_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ehebe/sharon"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+func TestSetEx(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	key := []byte("session")
+	if err := db.SetEx(key, []byte("alive"), time.Hour); err != nil {
+		t.Fatalf("SetEx failed: %v", err)
+	}
+	if got := db.Kget(key).String(); got != "alive" {
+		t.Errorf("expected alive before expiry, got %q", got)
+	}
+	ttl, err := db.Ttl(key)
+	if err != nil {
+		t.Fatalf("Ttl failed: %v", err)
+	}
+	if ttl <= 0 || ttl > time.Hour {
+		t.Errorf("expected ttl within an hour, got %v", ttl)
+	}
+
+	if err := db.SetEx(key, []byte("gone"), -time.Second); err != nil {
+		t.Fatalf("SetEx failed: %v", err)
+	}
+	if rs := db.Kget(key); !rs.NotFound() {
+		t.Errorf("expected expired key to be not found, got %s", rs.State)
+	}
+	if _, err := db.Ttl(key); err != errors.ErrNotFound {
+		t.Errorf("expected ErrNotFound on expired key, got %v", err)
+	}
+
+	// a plain Set must drop the old deadline
+	if err := db.Set(key, []byte("kept")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got := db.Kget(key).String(); got != "kept" {
+		t.Errorf("expected kept, got %q", got)
+	}
+	if ttl, err := db.Ttl(key); err != nil || ttl != -1 {
+		t.Errorf("expected -1 on non-expiring key, got %v %v", ttl, err)
+	}
+	if _, err := db.Ttl([]byte("missing")); err != errors.ErrNotFound {
+		t.Errorf("expected ErrNotFound on missing key, got %v", err)
+	}
+}
+
+func TestIncrExpired(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	key := []byte("counter")
+	_ = db.SetEx(key, sharon.Uint64ToBytes(41), -time.Second)
+	if got := db.GetInt(key); got != 0 {
+		t.Errorf("expected 0 from an expired counter, got %d", got)
+	}
+	n, err := db.Incr(key, 1)
+	if err != nil || n != 1 {
+		t.Fatalf("expected an expired counter to restart at 1, got %d %v", n, err)
+	}
+	if ttl, err := db.Ttl(key); err != nil || ttl != -1 {
+		t.Errorf("expected the deadline to be dropped, got %v %v", ttl, err)
+	}
+
+	// a live counter keeps its deadline
+	_ = db.SetEx(key, sharon.Uint64ToBytes(1), time.Hour)
+	if n, _ = db.Incr(key, 1); n != 2 || db.GetInt(key) != 2 {
+		t.Errorf("expected 2, got %d", n)
+	}
+	if ttl, err := db.Ttl(key); err != nil || ttl <= 0 {
+		t.Errorf("expected the deadline to be kept, got %v %v", ttl, err)
+	}
+}
@@ -0,0 +1,116 @@
+package sharon
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The insertion order of a zset is kept in two meta indexes, insertion sequence to
+// member and member to its current sequence. Deleting a member removes both entries,
+// scans still skip entries whose member is gone or was added again later.
+
+// SetZsetInsertionOrder makes the zset writes record the insertion sequence of new members
+// so ZscanByInsertion can list them in the order they joined. It costs two extra puts per
+// new member and a read per deleted member, and is off by default. It must be set before
+// the DB is used concurrently.
+func (db *DB) SetZsetInsertionOrder(enabled bool) {
+	db.zsetInsertion = enabled
+}
+
+// stageZinsert stages recording key as the newest member of a zset into batch.
+func (db *DB) stageZinsert(batch *leveldb.Batch, nameB, key []byte) {
+	seqB := Uint64ToBytes(db.nextSeq())
+	batch.Put(Bconcat(zinsSeqPrefix(nameB), seqB), key)
+	batch.Put(Bconcat(zinsKeyPrefix(nameB), key), seqB)
+}
+
+// stageZinsertNew stages recording key as the newest member of a zset into batch unless it
+// is a member already.
+func (db *DB) stageZinsertNew(batch *leveldb.Batch, nameB, key []byte) error {
+	has, err := db.Has(Bconcat(zetScorePrefix, nameB, splitChar, key), nil)
+	if err == nil && !has {
+		db.stageZinsert(batch, nameB, key)
+	}
+	return err
+}
+
+// stageZuninsert stages removing key from the insertion order of a zset into batch.
+func (db *DB) stageZuninsert(batch *leveldb.Batch, nameB, key []byte) error {
+	keyEntry := Bconcat(zinsKeyPrefix(nameB), key)
+	seqB, err := db.Get(keyEntry, nil)
+	if err == errors.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	batch.Delete(keyEntry)
+	batch.Delete(Bconcat(zinsSeqPrefix(nameB), seqB))
+	return nil
+}
+
+// ZscanByInsertion returns up to limit members of a zset with their scores, in the order
+// they were added while insertion order was enabled.
+func (db *DB) ZscanByInsertion(name string, limit int) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	nameB := StringToBytesNoCopy(name)
+	seqPrefix := zinsSeqPrefix(nameB)
+	keyPrefix := zinsKeyPrefix(nameB)
+	scorePrefix := Bconcat(zetScorePrefix, nameB, splitChar)
+
+	n, size := 0, 0
+	iter := db.newIterator(util.BytesPrefix(seqPrefix), nil)
+	for iter.Next() {
+		key := iter.Value()
+		seqB, err := db.Get(Bconcat(keyPrefix, key), nil)
+		if err == nil && !bytes.Equal(seqB, iter.Key()[len(seqPrefix):]) {
+			continue
+		}
+		var score []byte
+		if err == nil {
+			score, err = db.Get(Bconcat(scorePrefix, key), nil)
+		}
+		if err == errors.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			iter.Release()
+			r.State = err.Error()
+			r.Data = []BS{}
+			return r
+		}
+		r.Data = append(r.Data, append([]byte{}, key...), score)
+		if db.replyFull(r, &size) {
+			iter.Release()
+			return r
+		}
+		n++
+		if n == limit {
+			break
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		r.State = err.Error()
+		r.Data = []BS{}
+		return r
+	}
+	if n > 0 {
+		r.State = replyOK
+	}
+	return r
+}
+
+func zinsSeqPrefix(nameB []byte) []byte {
+	return Bconcat(metaPrefix, []byte("zins"), splitChar, nameB, splitChar)
+}
+
+func zinsKeyPrefix(nameB []byte) []byte {
+	return Bconcat(metaPrefix, []byte("zinskey"), splitChar, nameB, splitChar)
+}
@@ -0,0 +1,86 @@
+package sharon_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ehebe/sharon"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func TestZscanByInsertion(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "leaderboard"
+	_ = db.Zset(name, []byte("early"), 1)
+	db.SetZsetInsertionOrder(true)
+	_ = db.Zset(name, []byte("carol"), 30)
+	_ = db.Zset(name, []byte("alice"), 10)
+	_ = db.Zset(name, []byte("bob"), 20)
+	_ = db.Zset(name, []byte("carol"), 5)
+	_ = db.Zset(name, []byte("dave"), 40)
+	_ = db.Zdel(name, []byte("dave"))
+	_ = db.Zset(name, []byte("alice"), 50)
+	_ = db.Zset(name, []byte("dave"), 15)
+
+	var keys []string
+	var scores []uint64
+	db.ZscanByInsertion(name, 0).KvEach(func(key, score sharon.BS) {
+		keys = append(keys, key.String())
+		scores = append(scores, score.Uint64())
+	})
+	want := []string{"carol", "alice", "bob", "dave"}
+	wantScores := []uint64{5, 50, 20, 15}
+	if len(keys) != len(want) {
+		t.Fatalf("expected %v, got %v", want, keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] || scores[i] != wantScores[i] {
+			t.Errorf("position %d: expected %s=%d, got %s=%d", i, want[i], wantScores[i], keys[i], scores[i])
+		}
+	}
+
+	if got := db.ZscanByInsertion(name, 2).KvLen(); got != 2 {
+		t.Errorf("expected limit 2 to return 2 members, got %d", got)
+	}
+}
+
+func TestZscanByInsertionAllWrites(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	db.SetZsetInsertionOrder(true)
+
+	name := "queue"
+	_, _ = db.Zincr(name, []byte("a"), 1)
+	_ = db.Zmset(name, [][]byte{[]byte("b"), sharon.Uint64ToBytes(2)})
+	_, _, _ = db.ZaddValidated(name, []sharon.ZEntry{{Key: []byte("c"), Score: 3}}, func(uint64) bool { return true })
+	_, _ = db.ZincrClamp(name, []byte("d"), 4, 0, 10)
+
+	var keys []string
+	db.ZscanByInsertion(name, 0).KvEach(func(key, _ sharon.BS) {
+		keys = append(keys, key.String())
+	})
+	if want := []string{"a", "b", "c", "d"}; !slices.Equal(keys, want) {
+		t.Fatalf("expected %v, got %v", want, keys)
+	}
+
+	metaEntries := func() int {
+		n := 0
+		iter := db.NewIterator(util.BytesPrefix([]byte{25, 'z', 'i', 'n', 's'}), nil)
+		for iter.Next() {
+			n++
+		}
+		iter.Release()
+		return n
+	}
+	_ = db.Zdel(name, []byte("a"))
+	_ = db.Zmdel(name, [][]byte{[]byte("b")})
+	if n := metaEntries(); n != 4 {
+		t.Errorf("expected the insertion entries of 2 members left, got %d entries", n)
+	}
+	_ = db.ZdelBucket(name)
+	if n := metaEntries(); n != 0 {
+		t.Errorf("expected no insertion entries after ZdelBucket, got %d", n)
+	}
+}
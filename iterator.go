@@ -0,0 +1,85 @@
+package sharon
+
+import (
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// HashIterator walks the entries of a hashmap in key order without building a Reply,
+// values are decoded by the DB codec. Like the scans it does not hide expired keys.
+// It must be released, and is not safe for concurrent use.
+type HashIterator struct {
+	db     *DB
+	iter   iterator.Iterator
+	prefix []byte
+	val    []byte
+	valid  bool
+	err    error
+}
+
+// NewHashIterator returns an iterator over the hashmap name, positioned before its first key.
+func (db *DB) NewHashIterator(name string) *HashIterator {
+	prefix := db.hashIteratorPrefix(name)
+	return db.newHashIterator(prefix, db.newIterator(util.BytesPrefix(prefix), nil))
+}
+
+func (db *DB) hashIteratorPrefix(name string) []byte {
+	return Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
+}
+
+// newHashIterator wraps iter, opened over the range of prefix.
+func (db *DB) newHashIterator(prefix []byte, iter iterator.Iterator) *HashIterator {
+	return &HashIterator{db: db, iter: iter, prefix: prefix}
+}
+
+// Next moves to the next entry, it returns false when exhausted or on error.
+func (it *HashIterator) Next() bool {
+	return it.load(it.err == nil && it.iter.Next())
+}
+
+// Seek moves to the first entry whose key is >= key, it returns false if there is none
+// or on error. Next then continues after it.
+func (it *HashIterator) Seek(key []byte) bool {
+	return it.load(it.err == nil && it.iter.Seek(Bconcat(it.prefix, key)))
+}
+
+func (it *HashIterator) load(ok bool) bool {
+	it.val, it.valid = nil, false
+	if !ok {
+		return false
+	}
+	if it.val, it.err = it.db.decodeValue(it.iter.Value()); it.err != nil {
+		return false
+	}
+	it.valid = true
+	return true
+}
+
+// Key returns the key of the current entry, it is only valid until the next move.
+func (it *HashIterator) Key() []byte {
+	if !it.valid {
+		return nil
+	}
+	return it.iter.Key()[len(it.prefix):]
+}
+
+// Value returns the decoded value of the current entry, it is only valid until the next move.
+func (it *HashIterator) Value() []byte {
+	if !it.valid {
+		return nil
+	}
+	return it.val
+}
+
+// Error returns the error that stopped the iteration, if any.
+func (it *HashIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.iter.Error()
+}
+
+// Release releases the underlying iterator, it is safe to call more than once.
+func (it *HashIterator) Release() {
+	it.iter.Release()
+}
@@ -0,0 +1,44 @@
+package sharon_test
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHashIteratorSeek(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "alpha"
+	for _, k := range []string{"a", "c", "e", "g", "i"} {
+		_ = db.Hset(name, []byte(k), []byte("v"+k))
+	}
+	_ = db.Hset("alphabet", []byte("z"), []byte("other"))
+
+	it := db.NewHashIterator(name)
+	defer it.Release()
+
+	if !it.Seek([]byte("d")) {
+		t.Fatalf("expected Seek to find a key >= d")
+	}
+	if string(it.Key()) != "e" || string(it.Value()) != "ve" {
+		t.Errorf("expected e=ve after Seek, got %s=%s", it.Key(), it.Value())
+	}
+	got := []string{string(it.Key())}
+	for it.Next() {
+		got = append(got, string(it.Key()))
+	}
+	if want := []string{"e", "g", "i"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+
+	if !it.Seek([]byte("a")) || string(it.Key()) != "a" {
+		t.Errorf("expected Seek back to a, got %s", it.Key())
+	}
+	if it.Seek([]byte("j")) {
+		t.Errorf("expected no key >= j, got %s", it.Key())
+	}
+}
@@ -0,0 +1,72 @@
+package sharon
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Loader buffers bulk hashmap writes and flushes them in batches, by entry count or,
+// once SetTargetBytes is called, by accumulated byte size. A Loader is not safe for
+// concurrent use.
+type Loader struct {
+	db          *DB
+	batch       *leveldb.Batch
+	maxEntries  int
+	targetBytes int
+	size        int
+	loaded      int64
+	loadedBytes int64
+}
+
+// NewLoader returns a Loader flushing every batchEntries entries, batchEntries <= 0
+// uses the LoadPrefix batch size.
+func (db *DB) NewLoader(batchEntries int) *Loader {
+	if batchEntries <= 0 {
+		batchEntries = loadChunk
+	}
+	return &Loader{db: db, batch: new(leveldb.Batch), maxEntries: batchEntries}
+}
+
+// SetTargetBytes makes the Loader flush by size rather than entry count, aiming at n bytes
+// of keys and values per batch: it flushes before the average entry size seen so far would
+// take the batch past n, so a batch exceeds n by at most its last entry.
+// n <= 0 restores the entry count.
+func (l *Loader) SetTargetBytes(n int) {
+	l.targetBytes = n
+}
+
+// Hset stages the value of the key of a hashmap, flushing the batch when full.
+func (l *Loader) Hset(name string, key, val []byte) error {
+	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
+	val = l.db.encodeValue(val)
+	l.batch.Put(realKey, val)
+	l.db.clearTTL(l.batch, realKey)
+
+	n := len(realKey) + len(val)
+	l.size += n
+	l.loaded++
+	l.loadedBytes += int64(n)
+	if l.full() {
+		return l.Flush()
+	}
+	return nil
+}
+
+func (l *Loader) full() bool {
+	if l.targetBytes <= 0 {
+		return l.batch.Len() >= l.maxEntries
+	}
+	return int64(l.size)+l.loadedBytes/l.loaded > int64(l.targetBytes)
+}
+
+// Flush writes the staged entries, it must be called once loading is done.
+func (l *Loader) Flush() error {
+	if l.batch.Len() == 0 {
+		return nil
+	}
+	if err := l.db.write(l.batch); err != nil {
+		return err
+	}
+	l.batch.Reset()
+	l.size = 0
+	return nil
+}
@@ -0,0 +1,89 @@
+package sharon_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+type batchSizes struct {
+	size, largest int
+}
+
+func (b *batchSizes) Put(key, value []byte) {
+	n := len(key) + len(value)
+	b.size += n
+	b.largest = max(b.largest, n)
+}
+
+func (b *batchSizes) Delete(key []byte) {}
+
+func TestLoaderTargetBytes(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	const target = 64 << 10
+	batches := 0
+	db.SetWriteFunc(func(batch *leveldb.Batch) error {
+		batches++
+		var s batchSizes
+		if err := batch.Replay(&s); err != nil {
+			return err
+		}
+		if s.size-s.largest > target {
+			t.Errorf("batch of %d bytes exceeds the target by more than one entry", s.size)
+		}
+		return db.Write(batch, nil)
+	})
+
+	l := db.NewLoader(0)
+	l.SetTargetBytes(target)
+	sizes := []int{1, 10, 30000, 100, 5, 70000, 2, 4000, 12}
+	for i := 0; i < 200; i++ {
+		val := bytes.Repeat([]byte{'x'}, sizes[i%len(sizes)])
+		if err := l.Hset("bulk", []byte(fmt.Sprintf("k%03d", i)), val); err != nil {
+			t.Fatalf("Hset failed: %v", err)
+		}
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if batches < 2 {
+		t.Errorf("expected several batches, got %d", batches)
+	}
+
+	for i := 0; i < 200; i++ {
+		if got := len(db.Hget("bulk", []byte(fmt.Sprintf("k%03d", i))).Bytes()); got != sizes[i%len(sizes)] {
+			t.Fatalf("key %d: expected %d bytes, got %d", i, sizes[i%len(sizes)], got)
+		}
+	}
+}
+
+func TestLoaderEntries(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	batches := 0
+	db.SetWriteFunc(func(batch *leveldb.Batch) error {
+		batches++
+		if batch.Len() > 10 {
+			t.Errorf("expected at most 10 entries per batch, got %d", batch.Len())
+		}
+		return db.Write(batch, nil)
+	})
+	l := db.NewLoader(10)
+	for i := 0; i < 25; i++ {
+		_ = l.Hset("bulk", []byte(fmt.Sprintf("k%02d", i)), []byte("v"))
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if batches != 3 {
+		t.Errorf("expected 3 batches, got %d", batches)
+	}
+	if got := db.Hscan("bulk", nil, 0).KvLen(); got != 25 {
+		t.Errorf("expected 25 keys, got %d", got)
+	}
+}
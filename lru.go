@@ -0,0 +1,167 @@
+package sharon
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The access order of an LRU hashmap is tracked in a companion zset whose
+// scores are access sequences, the lowest score is the least recently used key.
+// Every write deleting a key of a hashmap removes it from the companion zset too.
+
+// HsetLRU set the value of the key of a hashmap and marks it as most recently used,
+// then evicts the least recently used keys while the hashmap holds more than maxEntries.
+// Counting the entries walks the companion zset, so it suits bounded hashmaps.
+func (db *DB) HsetLRU(name string, key, val []byte, maxEntries int) error {
+	nameB := StringToBytesNoCopy(name)
+	lruName := lruZsetName(nameB)
+	defer db.lockLRU(lruName)()
+
+	realKey := Bconcat(hashPrefix, nameB, splitChar, key)
+	db.lruUsed.Store(true)
+	batch := new(leveldb.Batch)
+	batch.Put(realKey, db.encodeValue(val))
+	db.clearTTL(batch, realKey)
+	if _, err := db.stageZset(batch, lruName, key, Uint64ToBytes(db.nextSeq())); err != nil {
+		return err
+	}
+	if err := db.write(batch); err != nil {
+		return err
+	}
+	return db.evictLRU(nameB, lruName, maxEntries)
+}
+
+// HgetLRU get the value of the key of a hashmap like Hget and marks it as most recently used.
+func (db *DB) HgetLRU(name string, key []byte) *Reply {
+	nameB := StringToBytesNoCopy(name)
+	lruName := lruZsetName(nameB)
+	defer db.lockLRU(lruName)()
+
+	r := db.Hget(name, key)
+	if !r.OK() {
+		return r
+	}
+	batch := new(leveldb.Batch)
+	if _, err := db.stageZset(batch, lruName, key, Uint64ToBytes(db.nextSeq())); err != nil {
+		return &Reply{State: err.Error(), Data: []BS{}}
+	}
+	if err := db.write(batch); err != nil {
+		return &Reply{State: err.Error(), Data: []BS{}}
+	}
+	return r
+}
+
+func (db *DB) evictLRU(nameB, lruName []byte, maxEntries int) error {
+	scorePrefix := Bconcat(zetScorePrefix, lruName, splitChar)
+	count := 0
+	iter := db.newIterator(util.BytesPrefix(scorePrefix), nil)
+	for iter.Next() {
+		count++
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if count <= maxEntries {
+		return nil
+	}
+
+	indexPrefix := Bconcat(zetKeyPrefix, lruName, splitChar)
+	keyBeginIndex := len(indexPrefix) + scoreByteLen + 1
+	batch := new(leveldb.Batch)
+	iter = db.newIterator(util.BytesPrefix(indexPrefix), nil)
+	for n := count - maxEntries; n > 0 && iter.Next(); n-- {
+		key := append([]byte{}, iter.Key()[keyBeginIndex:]...)
+		score := iter.Key()[len(indexPrefix) : len(indexPrefix)+scoreByteLen]
+		realKey := Bconcat(hashPrefix, nameB, splitChar, key)
+		batch.Delete(realKey)
+		db.clearTTL(batch, realKey)
+		if err := db.stageZdel(batch, lruName, key, score); err != nil {
+			iter.Release()
+			return err
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return db.write(batch)
+}
+
+// lockLRU serializes the access order updates of the companion zsets lruNames. Its stripes
+// are apart from those of lockKey, so writes may take them while holding key locks.
+func (db *DB) lockLRU(lruNames ...[]byte) func() {
+	return lockStriped(&db.lruLocks, lruNames)
+}
+
+// lruWrites collects the hashmap keys a batch deletes last and the companion zsets it writes.
+type lruWrites struct {
+	deletes map[string]bool
+	zsets   map[string]bool
+}
+
+func (w *lruWrites) write(key []byte, put bool) {
+	if len(key) > 0 && key[0] == hashPrefix[0] {
+		w.deletes[string(key)] = !put
+	} else if bytes.HasPrefix(key, lruScorePrefix) {
+		if i := bytes.IndexByte(key[len(lruScorePrefix):], splitChar[0]); i >= 0 {
+			w.zsets[string(key[len(zetScorePrefix):len(lruScorePrefix)+i])] = true
+		}
+	}
+}
+
+func (w *lruWrites) Put(key, _ []byte) { w.write(key, true) }
+func (w *lruWrites) Delete(key []byte) { w.write(key, false) }
+
+// forgetLRU stages removing every hashmap key batch deletes from its companion zset, unless
+// batch writes that zset itself, and locks them until the returned unlock is called. Batches
+// writing a companion zset come from callers already holding its lock.
+func (db *DB) forgetLRU(batch *leveldb.Batch) (unlock func(), err error) {
+	w := lruWrites{deletes: map[string]bool{}, zsets: map[string]bool{}}
+	if err = batch.Replay(&w); err != nil {
+		return nil, err
+	}
+	var lruNames, keys [][]byte
+	for realKey, deleted := range w.deletes {
+		nameKey := []byte(realKey[len(hashPrefix):])
+		i := bytes.IndexByte(nameKey, splitChar[0])
+		if !deleted || i < 0 {
+			continue
+		}
+		lruName := lruZsetName(nameKey[:i])
+		if !w.zsets[string(lruName)] {
+			lruNames = append(lruNames, lruName)
+			keys = append(keys, nameKey[i+1:])
+		}
+	}
+	if len(lruNames) == 0 {
+		return func() {}, nil
+	}
+	unlock = db.lockLRU(lruNames...)
+	for i, lruName := range lruNames {
+		score, err := db.getRaw(Bconcat(zetScorePrefix, lruName, splitChar, keys[i]))
+		if err == nil && score != nil {
+			err = db.stageZdel(batch, lruName, keys[i], score)
+		}
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+	}
+	return unlock, nil
+}
+
+// hasLRU reports whether any hashmap has a companion zset.
+func (db *DB) hasLRU() bool {
+	iter := db.DB.NewIterator(util.BytesPrefix(lruScorePrefix), nil)
+	defer iter.Release()
+	return iter.First()
+}
+
+var lruScorePrefix = Bconcat(zetScorePrefix, metaPrefix, []byte("lru"), splitChar)
+
+func lruZsetName(nameB []byte) []byte {
+	return Bconcat(metaPrefix, []byte("lru"), splitChar, nameB)
+}
@@ -0,0 +1,64 @@
+package sharon_test
+
+import "testing"
+
+func TestHsetLRU(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "cache"
+	for _, k := range []string{"a", "b", "c"} {
+		if err := db.HsetLRU(name, []byte(k), []byte("v"+k), 3); err != nil {
+			t.Fatalf("HsetLRU failed: %v", err)
+		}
+	}
+	if got := db.HgetLRU(name, []byte("a")).String(); got != "va" {
+		t.Fatalf("expected va, got %q", got)
+	}
+
+	if err := db.HsetLRU(name, []byte("d"), []byte("vd"), 3); err != nil {
+		t.Fatalf("HsetLRU failed: %v", err)
+	}
+	if db.HhasKey(name, []byte("b")) {
+		t.Errorf("expected least recently used key b to be evicted")
+	}
+	for _, k := range []string{"a", "c", "d"} {
+		if !db.HhasKey(name, []byte(k)) {
+			t.Errorf("expected %s to survive", k)
+		}
+	}
+	if n := db.Hscan(name, nil, 0).KvLen(); n != 3 {
+		t.Errorf("expected 3 entries, got %d", n)
+	}
+}
+
+func TestHsetLRUDelete(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "sessions"
+	companion := string([]byte{25}) + "lru" + string([]byte{28}) + name
+	for _, k := range []string{"a", "b", "c"} {
+		_ = db.HsetLRU(name, []byte(k), []byte("v"), 3)
+	}
+
+	// deleted keys leave the access order, they must not count against maxEntries
+	_ = db.Hdel(name, []byte("b"))
+	_ = db.Hmdel(name, [][]byte{[]byte("c")})
+	if n := db.Zscan(companion, nil, nil, 0).KvLen(); n != 1 {
+		t.Errorf("expected 1 tracked key, got %d", n)
+	}
+	for _, k := range []string{"d", "e"} {
+		_ = db.HsetLRU(name, []byte(k), []byte("v"), 3)
+	}
+	for _, k := range []string{"a", "d", "e"} {
+		if !db.HhasKey(name, []byte(k)) {
+			t.Errorf("expected %s to survive", k)
+		}
+	}
+
+	_ = db.HdelBucket(name)
+	if n := db.Zscan(companion, nil, nil, 0).KvLen(); n != 0 {
+		t.Errorf("expected the bucket delete to empty the access order, got %d keys", n)
+	}
+}
@@ -0,0 +1,103 @@
+package sharon
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// mergeCompactDeltas is the number of pending deltas from which HgetMerged folds them into the value.
+const mergeCompactDeltas = 64
+
+// HmergeAdd records delta for the counter at key of a hashmap without reading it, so concurrent
+// adds never lose updates. Each delta is its own record until HgetMerged folds them into the value,
+// deleting the key drops its pending deltas.
+func (db *DB) HmergeAdd(name string, key []byte, delta int64) error {
+	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
+	db.mergeUsed.Store(true)
+	return db.put(Bconcat(mergeDeltaPrefix(realKey), Uint64ToBytes(db.nextSeq())), Uint64ToBytes(uint64(delta)))
+}
+
+// HgetMerged get the counter at key of a hashmap with its pending deltas applied.
+// Once enough deltas piled up they are compacted into the stored value; a concurrent
+// Hset of the same key may be overwritten by that compaction.
+func (db *DB) HgetMerged(name string, key []byte) (uint64, error) {
+	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
+	defer db.lockKey(realKey)()
+
+	var total uint64
+	val, err := db.hget(realKey)
+	if err == nil {
+		total = BytesToUint64(val)
+	} else if err != errors.ErrNotFound {
+		return 0, err
+	}
+
+	batch := new(leveldb.Batch)
+	n := 0
+	iter := db.newIterator(util.BytesPrefix(mergeDeltaPrefix(realKey)), nil)
+	for iter.Next() {
+		if total, err = incrBy(total, int64(BytesToUint64(iter.Value()))); err != nil {
+			iter.Release()
+			return 0, err
+		}
+		batch.Delete(iter.Key())
+		n++
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return 0, err
+	}
+
+	if n >= mergeCompactDeltas {
+		batch.Put(realKey, db.encodeValue(Uint64ToBytes(total)))
+		if err = db.write(batch); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// clearMergeDeltas stages the removal of the pending deltas of every hashmap key batch deletes.
+func (db *DB) clearMergeDeltas(batch *leveldb.Batch) error {
+	w := hashWrites{keys: map[string]bool{}, versions: map[string]bool{}}
+	if err := batch.Replay(&w); err != nil {
+		return err
+	}
+	for realKey, put := range w.keys {
+		if put {
+			continue
+		}
+		if err := db.clearMergeDeltasUnder(batch, Bconcat([]byte(realKey), splitChar)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearMergeDeltasUnder stages the removal of the pending deltas of every hashmap key starting
+// with keyPrefix, including counters only made of deltas.
+func (db *DB) clearMergeDeltasUnder(batch *leveldb.Batch, keyPrefix []byte) error {
+	if !db.mergeUsed.Load() {
+		return nil
+	}
+	iter := db.DB.NewIterator(util.BytesPrefix(Bconcat(mergeDeltasPrefix, keyPrefix)), nil)
+	for iter.Next() {
+		batch.Delete(iter.Key())
+	}
+	iter.Release()
+	return iter.Error()
+}
+
+// hasMergeDeltas reports whether any hashmap key has pending deltas.
+func (db *DB) hasMergeDeltas() bool {
+	iter := db.DB.NewIterator(util.BytesPrefix(mergeDeltasPrefix), nil)
+	defer iter.Release()
+	return iter.First()
+}
+
+var mergeDeltasPrefix = Bconcat(metaPrefix, []byte("merge"), splitChar)
+
+func mergeDeltaPrefix(realKey []byte) []byte {
+	return Bconcat(mergeDeltasPrefix, realKey, splitChar)
+}
@@ -0,0 +1,80 @@
+package sharon_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestHmergeAdd(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "hits"
+	key := []byte("page")
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := db.HmergeAdd(name, key, 2); err != nil {
+					t.Errorf("HmergeAdd failed: %v", err)
+					return
+				}
+				if i%10 == 0 {
+					if _, err := db.HgetMerged(name, key); err != nil {
+						t.Errorf("HgetMerged failed: %v", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	total, err := db.HgetMerged(name, key)
+	if err != nil {
+		t.Fatalf("HgetMerged failed: %v", err)
+	}
+	if total != 800 {
+		t.Errorf("expected 800, got %d", total)
+	}
+
+	if err = db.HmergeAdd(name, key, -300); err != nil {
+		t.Fatalf("HmergeAdd failed: %v", err)
+	}
+	if total, _ = db.HgetMerged(name, key); total != 500 {
+		t.Errorf("expected 500, got %d", total)
+	}
+}
+
+func TestHmergeAddDelete(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "votes"
+	for _, key := range []string{"a", "b"} {
+		_ = db.Hset(name, []byte(key), sharon.Uint64ToBytes(10))
+		_ = db.HmergeAdd(name, []byte(key), 5)
+	}
+
+	// deleting a counter drops its pending deltas with it
+	_ = db.Hdel(name, []byte("a"))
+	if total, err := db.HgetMerged(name, []byte("a")); err != nil || total != 0 {
+		t.Errorf("expected a deleted counter to restart at 0, got %d (%v)", total, err)
+	}
+	_ = db.HmergeAdd(name, []byte("a"), 3)
+	if total, _ := db.HgetMerged(name, []byte("a")); total != 3 {
+		t.Errorf("expected 3, got %d", total)
+	}
+
+	_ = db.HdelBucket(name)
+	for _, key := range []string{"a", "b"} {
+		if total, _ := db.HgetMerged(name, []byte(key)); total != 0 {
+			t.Errorf("%s: expected the bucket delete to drop the deltas, got %d", key, total)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package sharon
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// HscanMulti list key-value pairs after keyStart of the union of several hashmaps, merged in
+// key order. A key present in more than one hashmap is returned once, with the value of the
+// first listed hashmap holding it.
+func (db *DB) HscanMulti(names []string, keyStart []byte, limit int) *Reply {
+	r, _ := db.HscanMultiSources(names, keyStart, limit)
+	return r
+}
+
+// HscanMultiSources is like HscanMulti and also returns the name of the hashmap
+// each returned pair came from, in the same order.
+func (db *DB) HscanMultiSources(names []string, keyStart []byte, limit int) (*Reply, []string) {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	var sources []string
+
+	ranges := make([]*util.Range, len(names))
+	prefixLens := make([]int, len(names))
+	for i, name := range names {
+		keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
+		ranges[i] = util.BytesPrefix(keyPrefix)
+		ranges[i].Start = Bconcat(keyPrefix, keyStart)
+		prefixLens[i] = len(keyPrefix)
+	}
+	iters := db.newIterators(ranges, nil)
+	valid := make([]bool, len(names))
+	for i, iter := range iters {
+		defer iter.Release()
+		valid[i] = iter.First()
+		if valid[i] && len(keyStart) > 0 && bytes.Equal(iter.Key(), ranges[i].Start) {
+			valid[i] = iter.Next()
+		}
+	}
+	key := func(i int) []byte {
+		return iters[i].Key()[prefixLens[i]:]
+	}
+
+	n, size := 0, 0
+	for n == 0 || n != limit {
+		min := -1
+		for i := range iters {
+			if valid[i] && (min < 0 || bytes.Compare(key(i), key(min)) < 0) {
+				min = i
+			}
+		}
+		if min < 0 {
+			break
+		}
+
+		val, err := db.decodeValue(iters[min].Value())
+		if err != nil {
+			r.State = err.Error()
+			r.Data = []BS{}
+			return r, nil
+		}
+		minKey := append([]byte{}, key(min)...)
+		r.Data = append(r.Data, minKey, append([]byte{}, val...))
+		if db.replyFull(r, &size) {
+			return r, sources
+		}
+		sources = append(sources, names[min])
+		n++
+
+		for i := range iters {
+			if valid[i] && bytes.Equal(key(i), minKey) {
+				valid[i] = iters[i].Next()
+			}
+		}
+	}
+	for _, iter := range iters {
+		if err := iter.Error(); err != nil {
+			r.State = err.Error()
+			r.Data = []BS{}
+			return r, nil
+		}
+	}
+	if n > 0 {
+		r.State = replyOK
+	}
+	return r, sources
+}
@@ -0,0 +1,44 @@
+package sharon_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestHscanMulti(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	_ = db.Hmset("overrides", []byte("b"), []byte("b-override"), []byte("d"), []byte("d-override"))
+	_ = db.Hmset("defaults", []byte("a"), []byte("a-default"), []byte("b"), []byte("b-default"),
+		[]byte("c"), []byte("c-default"), []byte("d"), []byte("d-default"), []byte("e"), []byte("e-default"))
+
+	names := []string{"overrides", "defaults"}
+	rs, sources := db.HscanMultiSources(names, nil, 0)
+	var got []string
+	rs.KvEach(func(key, value sharon.BS) {
+		got = append(got, key.String()+"="+value.String())
+	})
+	want := []string{"a=a-default", "b=b-override", "c=c-default", "d=d-override", "e=e-default"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	wantSources := []string{"defaults", "overrides", "defaults", "overrides", "defaults"}
+	if !slices.Equal(sources, wantSources) {
+		t.Errorf("expected sources %v, got %v", wantSources, sources)
+	}
+
+	got = got[:0]
+	db.HscanMulti(names, []byte("b"), 2).KvEach(func(key, value sharon.BS) {
+		got = append(got, key.String())
+	})
+	if !slices.Equal(got, []string{"c", "d"}) {
+		t.Errorf("expected [c d] after b with limit 2, got %v", got)
+	}
+
+	if rs = db.HscanMulti([]string{"none", "empty"}, nil, 0); rs.OK() {
+		t.Errorf("expected no entries, got %s", rs.Debug())
+	}
+}
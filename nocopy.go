@@ -0,0 +1,30 @@
+//go:build !sharon_safe
+
+package sharon
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// The keys and replies of this package convert between names and bytes without copying.
+// The result aliases the memory of its source: a string from BytesToStringNoCopy, such as
+// the keys of Reply.Dict or BS.String, changes when the bytes of the reply are modified, and
+// modifying the slice from StringToBytesNoCopy breaks the immutability of the string and
+// faults for string literals. Building with the sharon_safe tag makes both copy instead.
+
+// BytesToStringNoCopy converts byte slice to a string without memory allocation.
+// []byte("abc") -> "abc" s
+func BytesToStringNoCopy(b []byte) string {
+	/* #nosec G103 */
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+// StringToBytesNoCopy converts string to a byte slice without memory allocation.
+// "abc" -> []byte("abc")
+func StringToBytesNoCopy(s string) []byte {
+	ptr := unsafe.StringData(s)
+	b := unsafe.Slice(ptr, len(s))
+	runtime.KeepAlive(&s)
+	return b
+}
@@ -0,0 +1,15 @@
+//go:build sharon_safe
+
+package sharon
+
+// BytesToStringNoCopy converts byte slice to a string. Built with the sharon_safe tag it
+// copies b, trading an allocation for memory safety.
+func BytesToStringNoCopy(b []byte) string {
+	return string(b)
+}
+
+// StringToBytesNoCopy converts string to a byte slice. Built with the sharon_safe tag it
+// copies s, trading an allocation for memory safety.
+func StringToBytesNoCopy(s string) []byte {
+	return []byte(s)
+}
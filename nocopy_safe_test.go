@@ -0,0 +1,33 @@
+//go:build sharon_safe
+
+package sharon_test
+
+import (
+	"testing"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestSafeConversions(t *testing.T) {
+	name := "safe"
+	b := sharon.StringToBytesNoCopy(name)
+	b[0] = 'S'
+	if name != "safe" {
+		t.Errorf("expected the string to be copied, got %q", name)
+	}
+
+	db := setupDB(t)
+	defer db.Close()
+
+	_ = db.Hset(name, []byte("key"), []byte("val"))
+	rs := db.Hscan(name, nil, 0)
+	dict := rs.Dict()
+	key, val := rs.Data[0].String(), rs.Data[1].String()
+	rs.Data[0][0], rs.Data[1][0] = 'x', 'x'
+	if key != "key" || val != "val" {
+		t.Errorf("expected strings to outlive changes of the reply, got %q %q", key, val)
+	}
+	if _, ok := dict["key"]; !ok {
+		t.Errorf("expected the keys of Dict to be copied, got %v", dict)
+	}
+}
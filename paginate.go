@@ -0,0 +1,94 @@
+package sharon
+
+import (
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ZPaginator pages through the key-score pairs of a zset in score order, reading from the
+// snapshot taken when it was created so writes made meanwhile never skip or repeat members.
+// It must be closed to release the snapshot.
+type ZPaginator struct {
+	mu       sync.Mutex
+	snap     *leveldb.Snapshot
+	err      error
+	prefix   []byte
+	last     []byte
+	pageSize int
+	done     bool
+}
+
+// ZscanPaginator returns a paginator over the zset name yielding pageSize pairs per page,
+// pageSize <= 0 yields the whole zset in one page.
+func (db *DB) ZscanPaginator(name string, pageSize int) *ZPaginator {
+	p := &ZPaginator{
+		prefix:   Bconcat(zetKeyPrefix, StringToBytesNoCopy(name), splitChar),
+		pageSize: pageSize,
+	}
+	p.snap, p.err = db.GetSnapshot()
+	return p
+}
+
+// Next returns the next page, and false once the zset is exhausted, the paginator is closed
+// or reading failed, in which case the reply state holds the error.
+func (p *ZPaginator) Next() (*Reply, bool) {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		r.State = p.err.Error()
+		return r, false
+	}
+	if p.done || p.snap == nil {
+		return r, false
+	}
+
+	rg := util.BytesPrefix(p.prefix)
+	if p.last != nil {
+		rg.Start = Bconcat(p.last, []byte{0})
+	}
+	scoreEndIndex := len(p.prefix) + scoreByteLen
+	iter := p.snap.NewIterator(rg, nil)
+	n := 0
+	for iter.Next() {
+		r.Data = append(r.Data,
+			append([]byte{}, iter.Key()[scoreEndIndex+1:]...),            // key
+			append([]byte{}, iter.Key()[len(p.prefix):scoreEndIndex]...), // score
+		)
+		n++
+		if n == p.pageSize {
+			p.last = append(p.last[:0], iter.Key()...)
+			break
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		p.err = err
+		r.State = err.Error()
+		r.Data = []BS{}
+		return r, false
+	}
+	if n != p.pageSize {
+		p.done = true
+	}
+	if n == 0 {
+		return r, false
+	}
+	r.State = replyOK
+	return r, true
+}
+
+// Close releases the snapshot, it is safe to call more than once.
+func (p *ZPaginator) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.snap != nil {
+		p.snap.Release()
+		p.snap = nil
+	}
+}
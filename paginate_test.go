@@ -0,0 +1,56 @@
+package sharon_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestZscanPaginator(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "ladder"
+	var want []string
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("p%d", i)
+		_ = db.Zset(name, []byte(key), uint64(i*10))
+		want = append(want, fmt.Sprintf("%s=%d", key, i*10))
+	}
+
+	p := db.ZscanPaginator(name, 3)
+	defer p.Close()
+
+	var got []string
+	pages := 0
+	for rs, ok := p.Next(); ok; rs, ok = p.Next() {
+		pages++
+		rs.KvEach(func(key, value sharon.BS) {
+			got = append(got, fmt.Sprintf("%s=%d", key, sharon.BytesToScore(value)))
+		})
+		if pages == 1 {
+			// move an already seen member ahead and an unseen one behind the cursor
+			_ = db.Zset(name, []byte("p0"), 1000)
+			_ = db.Zset(name, []byte("p9"), 5)
+			_ = db.Zset(name, []byte("late"), 50)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected snapshot view %v, got %v", want, got)
+	}
+	if pages != 4 {
+		t.Errorf("expected 4 pages, got %d", pages)
+	}
+	if _, ok := p.Next(); ok {
+		t.Errorf("expected exhausted paginator")
+	}
+
+	p.Close()
+	p = db.ZscanPaginator(name, 0)
+	defer p.Close()
+	if rs, ok := p.Next(); !ok || rs.KvLen() != 11 {
+		t.Errorf("expected the current 11 members in one page, got %d", rs.KvLen())
+	}
+}
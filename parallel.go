@@ -0,0 +1,196 @@
+package sharon
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// HscanParallel scans all entries of a hashmap with shards goroutines, each covering a
+// sub-range of the keys. fn must be safe for concurrent use, key and value are only valid
+// during the call. It returns the first error encountered.
+func (db *DB) HscanParallel(name string, shards int, fn func(key, value []byte)) error {
+	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
+	if shards < 1 {
+		shards = 1
+	}
+	ranges, err := db.SplitRange(keyPrefix, shards)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(ranges))
+	for i := range ranges {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			iter := db.newIterator(&ranges[i], nil)
+			defer iter.Release()
+			for iter.Next() {
+				val, err := db.decodeValue(iter.Value())
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				fn(iter.Key()[len(keyPrefix):], val)
+			}
+			errs[i] = iter.Error()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SplitRange divides the keys under prefix into n contiguous ranges of roughly equal data size.
+// It weighs the ranges of each value of the byte following prefix with SizeOf and keeps
+// splitting the heaviest one on its next byte, so keys sharing leading bytes are spread too.
+// When nothing under prefix is flushed to table files yet, the keys are counted instead.
+func (db *DB) SplitRange(prefix []byte, n int) ([]util.Range, error) {
+	if n < 1 {
+		return nil, errors.New("n must be positive")
+	}
+	whole := util.BytesPrefix(prefix)
+	top := splitCell{Range: *whole, head: prefix, splittable: true}
+	cells, err := db.subCells(prefix, top, db.rangeSizes)
+	if err != nil {
+		return nil, err
+	}
+	weigh := db.rangeSizes
+	if cellsWeight(cells) == 0 {
+		// only the memtable holds keys under prefix, counting them is cheap
+		weigh = db.rangeCounts
+		if cells, err = db.subCells(prefix, top, weigh); err != nil {
+			return nil, err
+		}
+	}
+
+	for splits := 0; splits < n*splitMaxDepth; splits++ {
+		heaviest, nonEmpty := -1, 0
+		for i, c := range cells {
+			if c.weight > 0 {
+				nonEmpty++
+			}
+			if c.splittable && c.weight > 0 && (heaviest < 0 || c.weight > cells[heaviest].weight) {
+				heaviest = i
+			}
+		}
+		if nonEmpty >= n || heaviest < 0 {
+			break
+		}
+		children, err := db.subCells(prefix, cells[heaviest], weigh)
+		if err != nil {
+			return nil, err
+		}
+		if cellsWeight(children) == 0 {
+			// finer than SizeOf can tell apart
+			cells[heaviest].splittable = false
+			continue
+		}
+		cells = slices.Replace(cells, heaviest, heaviest+1, children...)
+	}
+
+	total := cellsWeight(cells)
+	ranges := make([]util.Range, n)
+	c, cum := 0, int64(0)
+	for i := range ranges {
+		if i == 0 {
+			ranges[i].Start = whole.Start
+		} else {
+			ranges[i].Start = ranges[i-1].Limit
+		}
+		if i == n-1 {
+			ranges[i].Limit = whole.Limit
+			break
+		}
+		if total == 0 {
+			// nothing to weigh, split evenly by the byte following prefix
+			c = (i + 1) * len(cells) / n
+		} else {
+			target := total * int64(i+1) / int64(n)
+			for c < len(cells) && cum+cells[c].weight <= target {
+				cum += cells[c].weight
+				c++
+			}
+		}
+		if c < len(cells) {
+			ranges[i].Limit = cells[c].Start
+		} else {
+			ranges[i].Limit = whole.Limit
+		}
+	}
+	return ranges, nil
+}
+
+// splitMaxDepth bounds how many bytes after the prefix SplitRange splits on.
+const splitMaxDepth = 8
+
+// splitCell is a range SplitRange may cut at its start, with its weight.
+type splitCell struct {
+	util.Range
+	head       []byte // the bytes all keys in the range start with
+	weight     int64
+	splittable bool
+}
+
+// subCells splits c into the 256 ranges of the byte following its head, weighed with weigh.
+func (db *DB) subCells(prefix []byte, c splitCell, weigh func([]util.Range) ([]int64, error)) ([]splitCell, error) {
+	depth := len(c.head) - len(prefix) + 1
+	heads := make([][]byte, 256)
+	ranges := make([]util.Range, 256)
+	for b := range ranges {
+		heads[b] = Bconcat(c.head, []byte{byte(b)})
+		ranges[b].Start = c.Start
+		if b > 0 {
+			ranges[b].Start = heads[b]
+			ranges[b-1].Limit = ranges[b].Start
+		}
+	}
+	ranges[255].Limit = c.Limit
+	weights, err := weigh(ranges)
+	if err != nil {
+		return nil, err
+	}
+	cells := make([]splitCell, len(ranges))
+	for i, r := range ranges {
+		cells[i] = splitCell{Range: r, head: heads[i], weight: weights[i], splittable: depth < splitMaxDepth}
+	}
+	return cells, nil
+}
+
+// rangeSizes weighs ranges by their approximate size in table files.
+func (db *DB) rangeSizes(ranges []util.Range) ([]int64, error) {
+	return db.SizeOf(ranges)
+}
+
+// rangeCounts weighs ranges by the number of keys they hold.
+func (db *DB) rangeCounts(ranges []util.Range) ([]int64, error) {
+	counts := make([]int64, len(ranges))
+	for i := range ranges {
+		iter := db.DB.NewIterator(&ranges[i], nil)
+		for iter.Next() {
+			counts[i]++
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+func cellsWeight(cells []splitCell) int64 {
+	var total int64
+	for _, c := range cells {
+		total += c.weight
+	}
+	return total
+}
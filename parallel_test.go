@@ -0,0 +1,132 @@
+package sharon_test
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ehebe/sharon"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func TestHscanParallel(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "large"
+	kvs := make([][]byte, 0, 6000)
+	for i := 0; i < 3000; i++ {
+		kvs = append(kvs, sharon.Uint64ToBytes(uint64(i)*0x9e3779b97f4a7c15), []byte("v"))
+	}
+	if err := db.Hmset(name, kvs...); err != nil {
+		t.Fatalf("Hmset failed: %v", err)
+	}
+	_ = db.Hset("other", []byte("x"), []byte("v"))
+
+	serial := db.Hscan(name, nil, 0).KvLen()
+	for _, shards := range []int{1, 4, 7} {
+		var count int64
+		err := db.HscanParallel(name, shards, func(key, value []byte) {
+			atomic.AddInt64(&count, 1)
+		})
+		if err != nil {
+			t.Fatalf("HscanParallel failed: %v", err)
+		}
+		if int(count) != serial {
+			t.Errorf("shards %d: expected %d entries, got %d", shards, serial, count)
+		}
+	}
+}
+
+func TestSplitRange(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "split"
+	kvs := make([][]byte, 0, 4000)
+	for i := 0; i < 2000; i++ {
+		kvs = append(kvs, sharon.Uint64ToBytes(uint64(i)*0x9e3779b97f4a7c15), make([]byte, 64))
+	}
+	if err := db.Hmset(name, kvs...); err != nil {
+		t.Fatalf("Hmset failed: %v", err)
+	}
+	if err := db.CompactRange(util.Range{}); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+
+	prefix := sharon.Bconcat([]byte{30}, []byte(name), []byte{28})
+	whole := util.BytesPrefix(prefix)
+	for _, n := range []int{1, 3, 8} {
+		ranges, err := db.SplitRange(prefix, n)
+		if err != nil {
+			t.Fatalf("SplitRange failed: %v", err)
+		}
+		if len(ranges) != n {
+			t.Fatalf("expected %d ranges, got %d", n, len(ranges))
+		}
+		if !bytes.Equal(ranges[0].Start, whole.Start) || !bytes.Equal(ranges[n-1].Limit, whole.Limit) {
+			t.Errorf("n=%d: ranges do not cover the prefix", n)
+		}
+		total := 0
+		for i, r := range ranges {
+			if bytes.Compare(r.Start, r.Limit) > 0 {
+				t.Errorf("n=%d: range %d is inverted", n, i)
+			}
+			if i > 0 && !bytes.Equal(ranges[i-1].Limit, r.Start) {
+				t.Errorf("n=%d: range %d is not contiguous with the previous one", n, i)
+			}
+			iter := db.NewIterator(&ranges[i], nil)
+			for iter.Next() {
+				total++
+			}
+			iter.Release()
+		}
+		if total != 2000 {
+			t.Errorf("n=%d: expected ranges to hold 2000 keys, got %d", n, total)
+		}
+	}
+}
+
+func TestSplitRangeSharedPrefix(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	// sequential ids share their first bytes, the split must look past them
+	name := "sequential"
+	kvs := make([][]byte, 0, 4000)
+	for i := 0; i < 2000; i++ {
+		kvs = append(kvs, sharon.Uint64ToBytes(uint64(i)), make([]byte, 64))
+	}
+	if err := db.Hmset(name, kvs...); err != nil {
+		t.Fatalf("Hmset failed: %v", err)
+	}
+
+	prefix := sharon.Bconcat([]byte{30}, []byte(name), []byte{28})
+	for _, flushed := range []bool{false, true} {
+		if flushed {
+			if err := db.CompactRange(util.Range{}); err != nil {
+				t.Fatalf("CompactRange failed: %v", err)
+			}
+		}
+		ranges, err := db.SplitRange(prefix, 4)
+		if err != nil {
+			t.Fatalf("SplitRange failed: %v", err)
+		}
+		total := 0
+		for i := range ranges {
+			count := 0
+			iter := db.NewIterator(&ranges[i], nil)
+			for iter.Next() {
+				count++
+			}
+			iter.Release()
+			if count < 250 {
+				t.Errorf("flushed=%v: expected range %d to hold a fair share, got %d keys", flushed, i, count)
+			}
+			total += count
+		}
+		if total != 2000 {
+			t.Errorf("flushed=%v: expected ranges to hold 2000 keys, got %d", flushed, total)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package sharon
+
+import (
+	"github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// HscanResumable list the next limit key-value pairs of a hashmap for the scan job jobID,
+// saving its position under metaPrefix+"hresume"+splitChar+jobID before returning, so a job
+// restarted with the same jobID continues after the last returned key. It returns false once
+// the scan is complete, the position is then removed and the next call starts over.
+// A job must not be run concurrently with itself.
+func (db *DB) HscanResumable(name, jobID string, limit int) (*Reply, bool) {
+	marker := Bconcat(metaPrefix, []byte("hresume"), splitChar, StringToBytesNoCopy(jobID))
+	last, err := db.Get(marker, nil)
+	if err != nil && err != errors.ErrNotFound {
+		return &Reply{State: err.Error(), Data: []BS{}}, false
+	}
+
+	// a saved position is exclusive, a fresh job includes the first key even if empty
+	r := db.hscan(name, last, err == errors.ErrNotFound, limit)
+	full := (r.OK() && limit > 0 && r.KvLen() == limit) || (r.State == replyTooLarge && len(r.Data) > 0)
+	if !full {
+		// an empty scan reports replyError without data, anything else failed
+		if !r.OK() && (r.State != replyError || len(r.Data) > 0) {
+			return r, false
+		}
+		if err = db.delete(marker); err != nil {
+			return &Reply{State: err.Error(), Data: []BS{}}, false
+		}
+		return r, false
+	}
+	if err = db.put(marker, r.Data[len(r.Data)-2]); err != nil {
+		return &Reply{State: err.Error(), Data: []BS{}}, false
+	}
+	return r, true
+}
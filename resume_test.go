@@ -0,0 +1,52 @@
+package sharon_test
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHscanResumable(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "huge"
+	const total = 95
+	for i := 0; i < total; i++ {
+		_ = db.Hset(name, []byte(fmt.Sprintf("k%03d", i)), []byte("v"))
+	}
+	_ = db.Hset(name, []byte{}, []byte("empty key"))
+
+	seen := map[string]int{}
+	visit := func(limit int, calls int) bool {
+		for i := 0; i < calls; i++ {
+			rs, more := db.HscanResumable(name, "job", limit)
+			for _, e := range rs.List() {
+				seen[e.Key.String()]++
+			}
+			if !more {
+				return false
+			}
+		}
+		return true
+	}
+	// each round stands for a run of the job cut short by a crash
+	if !visit(10, 3) || !visit(7, 2) {
+		t.Fatalf("expected the scan to be unfinished")
+	}
+	if visit(20, 10) {
+		t.Fatalf("expected the scan to complete")
+	}
+	if len(seen) != total+1 {
+		t.Errorf("expected %d distinct keys, got %d", total+1, len(seen))
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Errorf("key %q visited %d times", k, n)
+		}
+	}
+
+	// a completed job starts over
+	if rs, more := db.HscanResumable(name, "job", 1); !more || rs.List()[0].Key.String() != "" {
+		t.Errorf("expected a fresh scan from the first key, got %v", rs.List())
+	}
+}
@@ -0,0 +1,47 @@
+package sharon
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// SetRetry makes writes retry failed attempts up to maxAttempts in total, waiting backoff
+// before the first retry and doubling it after each one. Not found, corruption and closed
+// DB errors are never retried. maxAttempts <= 1 disables retrying, which is the default.
+// It must be set before the DB is used concurrently.
+func (db *DB) SetRetry(maxAttempts int, backoff time.Duration) {
+	db.retryMax = maxAttempts
+	db.retryWait = backoff
+}
+
+func (db *DB) writeBatch(batch *leveldb.Batch) error {
+	if db.writeFn != nil {
+		return db.writeFn(batch)
+	}
+	return db.Write(batch, nil)
+}
+
+// retry runs fn until it succeeds, fails permanently or the attempt budget is spent.
+func (db *DB) retry(fn func() error) error {
+	wait := db.retryWait
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= db.retryMax || !transient(err) {
+			return err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func transient(err error) bool {
+	switch {
+	case err == errors.ErrNotFound, err == leveldb.ErrClosed, err == leveldb.ErrReadOnly:
+		return false
+	case errors.IsCorrupted(err):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package sharon_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+func TestSetRetry(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	failures := 0
+	db.SetWriteFunc(func(batch *leveldb.Batch) error {
+		if failures < 2 {
+			failures++
+			return errors.New("transient")
+		}
+		return db.Write(batch, nil)
+	})
+
+	if err := db.Hset("retry", []byte("k"), []byte("v")); err == nil {
+		t.Fatalf("expected failure without retry policy")
+	}
+
+	failures = 0
+	db.SetRetry(3, time.Millisecond)
+	if err := db.Hset("retry", []byte("k"), []byte("v")); err != nil {
+		t.Fatalf("expected write to succeed within 3 attempts, got %v", err)
+	}
+	if failures != 2 {
+		t.Errorf("expected 2 failed attempts, got %d", failures)
+	}
+	if got := db.Hget("retry", []byte("k")).String(); got != "v" {
+		t.Errorf("expected v, got %q", got)
+	}
+
+	failures = 0
+	db.SetRetry(2, time.Millisecond)
+	if err := db.Hset("retry", []byte("k"), []byte("v")); err == nil {
+		t.Errorf("expected failure once the attempt budget is spent")
+	}
+
+	calls := 0
+	db.SetRetry(5, time.Millisecond)
+	db.SetWriteFunc(func(batch *leveldb.Batch) error {
+		calls++
+		return errors.NewErrCorrupted(storage.FileDesc{}, errors.New("bad block"))
+	})
+	_ = db.Hset("retry", []byte("k"), []byte("v"))
+	if calls != 1 {
+		t.Errorf("expected corruption not to be retried, got %d attempts", calls)
+	}
+}
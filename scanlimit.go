@@ -0,0 +1,229 @@
+package sharon
+
+import (
+	"bytes"
+	"sync/atomic"
+
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ErrTooManyScans is reported by the iterators of scans started while the maximum of
+// concurrent scans is reached, when scans are set to fail fast.
+var ErrTooManyScans = errors.New("too many concurrent scans")
+
+// limitedIterator gives its scan slot back on the first Release.
+type limitedIterator struct {
+	iterator.Iterator
+	slots    chan struct{}
+	released atomic.Bool
+}
+
+func (it *limitedIterator) Release() {
+	it.Iterator.Release()
+	if it.released.CompareAndSwap(false, true) {
+		<-it.slots
+	}
+}
+
+// SetMaxConcurrentScans limits the iterators live at once to n, further scans wait for
+// one to be released, or fail with ErrTooManyScans when failFast. Methods holding several
+// iterators at once, like ZjoinFunc and HscanMulti, take a slot for each of them in one step,
+// so they never wait for each other while holding slots. When they need more than n, they
+// read their ranges in chunks instead, one chunk at a time, and may see writes made between
+// chunks. The iterators of the embedded leveldb.DB are not limited.
+// n <= 0 removes the limit, which is the default. It must be set before the DB is used concurrently.
+func (db *DB) SetMaxConcurrentScans(n int, failFast bool) {
+	db.scanSlots = nil
+	if n > 0 {
+		db.scanSlots = make(chan struct{}, n)
+	}
+	db.scanFailFast = failFast
+}
+
+// newIterator is like leveldb's NewIterator but respects the concurrent scans limit.
+// With strict names, scans of a bucket with an empty name fail with ErrEmptyName.
+func (db *DB) newIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	return db.newIterators([]*util.Range{slice}, ro)[0]
+}
+
+// newIterators opens an iterator over each of slices, taking their scan slots at once.
+// When there are more slices than slots, it returns chunked iterators taking a slot per chunk.
+func (db *DB) newIterators(slices []*util.Range, ro *opt.ReadOptions) []iterator.Iterator {
+	iters := make([]iterator.Iterator, len(slices))
+	chunked := db.scanSlots != nil && len(slices) > cap(db.scanSlots)
+	taken, err := 0, error(nil)
+	if !chunked {
+		taken, err = db.acquireScans(len(slices))
+	}
+	for i, slice := range slices {
+		switch {
+		case db.strictNames && slice != nil && emptyName(slice.Start):
+			iters[i] = iterator.NewEmptyIterator(ErrEmptyName)
+			if i < taken {
+				<-db.scanSlots
+			}
+		case err != nil:
+			iters[i] = iterator.NewEmptyIterator(err)
+		case chunked:
+			iters[i] = newChunkIterator(db, slice, ro)
+		case i < taken:
+			iters[i] = &limitedIterator{Iterator: db.DB.NewIterator(slice, ro), slots: db.scanSlots}
+		default:
+			iters[i] = db.DB.NewIterator(slice, ro)
+		}
+	}
+	return iters
+}
+
+// acquireScans takes min(n, limit) scan slots, one caller at a time so that callers needing
+// several slots never hold some while waiting for others. It fails with ErrTooManyScans
+// instead of waiting when scans fail fast.
+func (db *DB) acquireScans(n int) (taken int, err error) {
+	if db.scanSlots == nil {
+		return 0, nil
+	}
+	n = min(n, cap(db.scanSlots))
+	db.scanMu.Lock()
+	defer db.scanMu.Unlock()
+	for taken < n {
+		if db.scanFailFast {
+			select {
+			case db.scanSlots <- struct{}{}:
+			default:
+				for ; taken > 0; taken-- {
+					<-db.scanSlots
+				}
+				return 0, ErrTooManyScans
+			}
+		} else {
+			db.scanSlots <- struct{}{}
+		}
+		taken++
+	}
+	return taken, nil
+}
+
+// scanChunk is the number of entries a chunkIterator reads per chunk.
+const scanChunk = 256
+
+// chunkIterator iterates forward over a range by reading it in chunks, each with its own
+// limited iterator, so it holds no scan slot between chunks. It does not support Last and Prev.
+type chunkIterator struct {
+	db         *DB
+	ro         *opt.ReadOptions
+	start      []byte
+	slice      util.Range
+	keys, vals [][]byte
+	pos        int
+	started    bool
+	exhausted  bool
+	err        error
+	releaser   util.Releaser
+}
+
+func newChunkIterator(db *DB, slice *util.Range, ro *opt.ReadOptions) *chunkIterator {
+	it := &chunkIterator{db: db, ro: ro}
+	if slice != nil {
+		it.slice = *slice
+		it.start = slice.Start
+	}
+	return it
+}
+
+// fill reads the chunk following the last one from the start of it.slice.
+func (it *chunkIterator) fill() bool {
+	it.keys, it.vals, it.pos = it.keys[:0], it.vals[:0], 0
+	if it.exhausted || it.err != nil {
+		return false
+	}
+	iter := it.db.newIterator(&it.slice, it.ro)
+	for len(it.keys) < scanChunk && iter.Next() {
+		it.keys = append(it.keys, append([]byte{}, iter.Key()...))
+		it.vals = append(it.vals, append([]byte{}, iter.Value()...))
+	}
+	iter.Release()
+	if it.err = iter.Error(); it.err != nil {
+		it.keys, it.vals = it.keys[:0], it.vals[:0]
+		return false
+	}
+	it.exhausted = len(it.keys) < scanChunk
+	if len(it.keys) > 0 {
+		it.slice.Start = Bconcat(it.keys[len(it.keys)-1], []byte{0})
+	}
+	return len(it.keys) > 0
+}
+
+func (it *chunkIterator) First() bool {
+	return it.Seek(nil)
+}
+
+func (it *chunkIterator) Seek(key []byte) bool {
+	it.started, it.exhausted = true, false
+	it.slice.Start = it.start
+	if bytes.Compare(key, it.start) > 0 {
+		it.slice.Start = key
+	}
+	return it.fill()
+}
+
+func (it *chunkIterator) Next() bool {
+	switch {
+	case !it.started:
+		return it.First()
+	case it.pos+1 < len(it.keys):
+		it.pos++
+		return true
+	}
+	return it.fill()
+}
+
+func (it *chunkIterator) Last() bool {
+	return it.unsupported()
+}
+
+func (it *chunkIterator) Prev() bool {
+	return it.unsupported()
+}
+
+func (it *chunkIterator) unsupported() bool {
+	it.keys, it.vals = it.keys[:0], it.vals[:0]
+	it.err = errors.New("chunked iterator only iterates forward")
+	return false
+}
+
+func (it *chunkIterator) Valid() bool {
+	return it.pos < len(it.keys)
+}
+
+func (it *chunkIterator) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.keys[it.pos]
+}
+
+func (it *chunkIterator) Value() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.vals[it.pos]
+}
+
+func (it *chunkIterator) Error() error {
+	return it.err
+}
+
+func (it *chunkIterator) Release() {
+	it.keys, it.vals = nil, nil
+	if it.releaser != nil {
+		it.releaser.Release()
+		it.releaser = nil
+	}
+}
+
+func (it *chunkIterator) SetReleaser(releaser util.Releaser) {
+	it.releaser = releaser
+}
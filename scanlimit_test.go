@@ -0,0 +1,162 @@
+package sharon_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestSetMaxConcurrentScans(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "scans"
+	for i := 0; i < 50; i++ {
+		_ = db.Hset(name, sharon.Uint64ToBytes(uint64(i)), []byte("v"))
+	}
+	db.SetMaxConcurrentScans(2, false)
+
+	// two unbuffered streams each hold an iterator until cancelled
+	ch1, cancel1 := db.HscanChan(name, nil, 0)
+	ch2, cancel2 := db.HscanChan(name, nil, 0)
+	<-ch1
+	<-ch2
+
+	done := make(chan *sharon.Reply)
+	go func() {
+		done <- db.Hscan(name, nil, 0)
+	}()
+	select {
+	case <-done:
+		t.Fatalf("expected third scan to wait for a free slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel1()
+	select {
+	case rs := <-done:
+		if rs.KvLen() != 50 {
+			t.Errorf("expected 50 entries, got %d (%s)", rs.KvLen(), rs.State)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected third scan to run once a slot was released")
+	}
+
+	db.SetMaxConcurrentScans(1, true)
+	ch3, cancel3 := db.HscanChan(name, nil, 0)
+	<-ch3
+	if rs := db.Hscan(name, nil, 0); rs.State != sharon.ErrTooManyScans.Error() {
+		t.Errorf("expected fail fast with %v, got %s", sharon.ErrTooManyScans, rs.State)
+	}
+	cancel3()
+	cancel2()
+
+	db.SetMaxConcurrentScans(3, false)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rs := db.Hscan(name, nil, 0); rs.KvLen() != 50 {
+				t.Errorf("expected 50 entries, got %d (%s)", rs.KvLen(), rs.State)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMaxConcurrentScansMultiIterator(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	for i := 0; i < 20; i++ {
+		key := sharon.Uint64ToBytes(uint64(i))
+		_ = db.Zset("za", key, uint64(i))
+		_ = db.Zset("zb", key, uint64(i))
+		_ = db.Hset("ha", key, []byte("a"))
+		_ = db.Hset("hb", key, []byte("b"))
+		_ = db.Hset("hc", key, []byte("c"))
+	}
+
+	for _, n := range []int{1, 2} {
+		db.SetMaxConcurrentScans(n, false)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					joined := 0
+					_ = db.ZjoinFunc("za", "zb", func(_ []byte, _, _ uint64, inA, inB bool) bool {
+						if inA && inB {
+							joined++
+						}
+						return true
+					})
+					if joined != 20 {
+						t.Errorf("limit %d: expected 20 joined members, got %d", n, joined)
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					if rs := db.HscanMulti([]string{"ha", "hb", "hc"}, nil, 0); rs.KvLen() != 20 {
+						t.Errorf("limit %d: expected 20 merged keys, got %d (%s)", n, rs.KvLen(), rs.State)
+					}
+				}()
+			}
+			wg.Wait()
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("limit %d: multi-iterator scans deadlocked", n)
+		}
+	}
+}
+
+func TestMaxConcurrentScansChunked(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	// more keys than a chunk, interleaved across the hashmaps
+	for i := 0; i < 900; i++ {
+		name := []string{"ca", "cb", "cc"}[i%3]
+		_ = db.Hset(name, sharon.Uint64ToBytes(uint64(i)), []byte(name))
+		_ = db.Zset([]string{"za", "zb"}[i%2], sharon.Uint64ToBytes(uint64(i)), uint64(i))
+	}
+	_ = db.Hset("cc", sharon.Uint64ToBytes(0), []byte("cc"))
+	db.SetMaxConcurrentScans(1, true)
+
+	rs := db.HscanMulti([]string{"ca", "cb", "cc"}, nil, 0)
+	if rs.KvLen() != 900 {
+		t.Fatalf("expected 900 merged keys, got %d (%s)", rs.KvLen(), rs.State)
+	}
+	for i, e := range rs.List() {
+		if got := sharon.BytesToUint64(e.Key); got != uint64(i) {
+			t.Fatalf("expected key %d at %d, got %d", i, i, got)
+		}
+	}
+	if got := rs.Dict()[string(sharon.Uint64ToBytes(0))]; string(got) != "ca" {
+		t.Errorf("expected the first listed hashmap to win, got %q", got)
+	}
+	if rs = db.HscanMulti([]string{"ca", "cb", "cc"}, sharon.Uint64ToBytes(299), 2); rs.KvLen() != 2 || sharon.BytesToUint64(rs.Data[0]) != 300 {
+		t.Errorf("expected a page of 2 after 299, got %v", rs.List())
+	}
+
+	// a join of more ranges than slots holds none between chunks
+	joined := 0
+	err := db.ZjoinFunc("za", "zb", func(_ []byte, _, _ uint64, _, _ bool) bool {
+		joined++
+		if rs := db.Hscan("ca", nil, 1); !rs.OK() {
+			t.Errorf("expected a scan within the join to get a slot, got %s", rs.State)
+			return false
+		}
+		return true
+	})
+	if err != nil || joined != 900 {
+		t.Errorf("expected 900 joined members, got %d (%v)", joined, err)
+	}
+}
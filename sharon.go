@@ -2,11 +2,21 @@ package sharon
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/binary"
+	"encoding/json"
 	"math"
-	"runtime"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
-	"unsafe"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
@@ -18,16 +28,41 @@ const (
 	replyOK              = "ok"
 	replyNotFound        = "leveldb: not found"
 	replyError           = "error"
+	replyTooLarge        = "reply size limit exceeded"
 	scoreByteLen         = 8
 	scoreMin      uint64 = 0
 	scoreMax      uint64 = math.MaxUint64
+	deleteChunk          = 1000
+	formatVersion        = 1
+	lockStripes          = 64
+	hgetallMax           = 100000
 )
 
 var (
+	// ErrCloseTimeout is returned by CloseWithTimeout when background goroutines did not stop in time.
+	ErrCloseTimeout = errors.New("close timeout: background goroutines still running")
+	// ErrFormatVersion is returned by Open when the DB was written by a newer format version.
+	ErrFormatVersion = errors.New("unsupported db format version")
+	// ErrValueTooLarge is returned by HsetCapped when the value exceeds the size cap.
+	ErrValueTooLarge = errors.New("value too large")
+	// ErrOddKVCount is returned by Hmset and Zmset when kvs does not hold key-value pairs.
+	ErrOddKVCount = errors.New("kvs length must be an even number")
+	// ErrInsufficientScore is returned by Ztransfer when the source member holds less than the amount.
+	ErrInsufficientScore = errors.New("insufficient score")
+	// ErrBucketTooLarge is returned by Hgetall when the hashmap holds more keys than the cap.
+	ErrBucketTooLarge = errors.New("bucket exceeds the Hgetall entry cap")
+)
+
+var (
+	flatPrefix     = []byte{27}
+	metaPrefix     = []byte{25}
+	ttlPrefix      = []byte{26}
 	hashPrefix     = []byte{30}
 	zetKeyPrefix   = []byte{31}
 	zetScorePrefix = []byte{29}
 	splitChar      = []byte{28}
+
+	formatVersionKey = Bconcat(metaPrefix, []byte("version"))
 )
 
 type (
@@ -35,6 +70,42 @@ type (
 	// DB embeds a leveldb.DB.
 	DB struct {
 		*leveldb.DB
+		path           string
+		options        *opt.Options
+		codec          ValueCodec
+		blockCache     *countingCacher
+		batchSink      func(batchDump []byte)
+		writeFn        func(batch *leveldb.Batch) error
+		readFn         func(key []byte, ro *opt.ReadOptions) ([]byte, error)
+		retryMax       int
+		retryWait      time.Duration
+		zsetInsertion  bool
+		zsetChampion   bool
+		maxReplyBytes  int
+		hgetallMax     int
+		scanSlots      chan struct{}
+		scanFailFast   bool
+		scanMu         sync.Mutex
+		trackMu        sync.Mutex
+		commitMu       sync.RWMutex
+		bucketTracking bool
+		strictNames    bool
+		ttlUsed        atomic.Bool
+		versionUsed    atomic.Bool
+		mergeUsed      atomic.Bool
+		lruUsed        atomic.Bool
+		seq            atomic.Uint64
+
+		quit     chan struct{}
+		quitOnce sync.Once
+		wg       sync.WaitGroup
+		closeMu  sync.Mutex
+		onClose  []func()
+
+		locks        [lockStripes]sync.Mutex
+		champLocks   [lockStripes]sync.Mutex
+		versionLocks [lockStripes]sync.Mutex
+		lruLocks     [lockStripes]sync.Mutex
 	}
 
 	// Reply a holder for a Entry list of a hashmap.
@@ -47,33 +118,569 @@ type (
 	Entry struct {
 		Key, Value BS
 	}
+
+	// ZEntry a key-score pair of a zset.
+	ZEntry struct {
+		Key   BS
+		Score uint64
+	}
+
+	// CompactResult reports what a CompactAll did, for logging.
+	CompactResult struct {
+		Duration   time.Duration
+		SizeBefore int64
+		SizeAfter  int64
+	}
+
+	// HDebugEntry a hashmap entry with its raw leveldb key, for diagnostics.
+	HDebugEntry struct {
+		Key, RawKey, Value BS
+	}
 )
 
 // Open creates/opens a DB at specified path, and returns a DB enclosing the same.
 func Open(dbPath string, o *opt.Options) (*DB, error) {
+	database, blockCache, err := openLevel(dbPath, o)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{DB: database, path: dbPath, options: o, quit: make(chan struct{}), blockCache: blockCache}
+	db.ttlUsed.Store(db.hasTTL())
+	db.versionUsed.Store(db.hasVersions())
+	db.mergeUsed.Store(db.hasMergeDeltas())
+	db.lruUsed.Store(db.hasLRU())
+	return db, nil
+}
+
+// openLevel opens the leveldb at dbPath, recovering it if corrupted, and checks its format version.
+func openLevel(dbPath string, o *opt.Options) (*leveldb.DB, *countingCacher, error) {
+	o, blockCache := withCountingBlockCache(o)
 	database, err := leveldb.OpenFile(dbPath, o)
 	if err != nil {
 		if errors.IsCorrupted(err) {
 			if database, err = leveldb.RecoverFile(dbPath, o); err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 		} else {
-			return nil, err
+			return nil, nil, err
+		}
+	}
+
+	if err = checkFormatVersion(database, o != nil && o.ReadOnly); err != nil {
+		_ = database.Close()
+		return nil, nil, err
+	}
+	return database, blockCache, nil
+}
+
+// Reopen closes the leveldb handle and opens it again with the path and options given to Open,
+// recovering it if corrupted, e.g. after a write failed with a corruption error. The settings
+// of the DB and its background goroutines are kept. It must not be called concurrently with
+// other methods, and if it fails the DB stays closed.
+func (db *DB) Reopen() error {
+	// a corrupted handle may fail to close cleanly, it is released either way
+	_ = db.DB.Close()
+	database, blockCache, err := openLevel(db.path, db.options)
+	if err != nil {
+		return err
+	}
+	db.DB, db.blockCache = database, blockCache
+	db.ttlUsed.Store(db.hasTTL())
+	db.versionUsed.Store(db.hasVersions())
+	db.mergeUsed.Store(db.hasMergeDeltas())
+	db.lruUsed.Store(db.hasLRU())
+	return nil
+}
+
+// hasTTL reports whether any key has a deadline.
+func (db *DB) hasTTL() bool {
+	iter := db.DB.NewIterator(util.BytesPrefix(ttlPrefix), nil)
+	defer iter.Release()
+	return iter.First()
+}
+
+// checkFormatVersion records the format version in a new DB and refuses DBs written by a newer one.
+func checkFormatVersion(database *leveldb.DB, readOnly bool) error {
+	val, err := database.Get(formatVersionKey, nil)
+	if err == errors.ErrNotFound {
+		if readOnly {
+			return nil
+		}
+		return database.Put(formatVersionKey, Uint64ToBytes(formatVersion), nil)
+	}
+	if err != nil {
+		return err
+	}
+	if BytesToUint64(val) > formatVersion {
+		return ErrFormatVersion
+	}
+	return nil
+}
+
+// FormatVersion returns the format version recorded in the DB.
+func (db *DB) FormatVersion() (int, error) {
+	val, err := db.Get(formatVersionKey, nil)
+	if err != nil {
+		return 0, err
+	}
+	return int(BytesToUint64(val)), nil
+}
+
+// Property returns the value of a leveldb property such as "leveldb.stats"
+// or "leveldb.num-files-at-level2".
+func (db *DB) Property(name string) (string, error) {
+	return db.GetProperty(name)
+}
+
+// HealthCheck verifies the DB is readable with a few cheap reads, it returns the error
+// leveldb reports, e.g. on corruption or after Close, and writes nothing.
+func (db *DB) HealthCheck() error {
+	if _, err := db.GetProperty("leveldb.num-files-at-level0"); err != nil {
+		return err
+	}
+	ro := &opt.ReadOptions{Strict: opt.StrictAll, DontFillCache: true}
+	if _, err := db.Get(formatVersionKey, ro); err != nil && err != errors.ErrNotFound {
+		return err
+	}
+	iter := db.newIterator(util.BytesPrefix(metaPrefix), ro)
+	iter.First()
+	iter.Release()
+	return iter.Error()
+}
+
+// TotalKeys returns the number of keys in the whole DB, including internal meta keys.
+func (db *DB) TotalKeys() (int64, error) {
+	var n int64
+	iter := db.newIterator(nil, nil)
+	for iter.Next() {
+		n++
+	}
+	iter.Release()
+	return n, iter.Error()
+}
+
+// KeyCountByType counts the keys of the whole DB by their type in one pass. Every zset
+// member has both a score and an index entry, internal meta keys are not counted.
+func (db *DB) KeyCountByType() (hash, zsetScore, zsetIndex, flat int64, err error) {
+	iter := db.newIterator(nil, nil)
+	for iter.Next() {
+		switch iter.Key()[0] {
+		case hashPrefix[0]:
+			hash++
+		case zetScorePrefix[0]:
+			zsetScore++
+		case zetKeyPrefix[0]:
+			zsetIndex++
+		case flatPrefix[0]:
+			flat++
+		}
+	}
+	iter.Release()
+	err = iter.Error()
+	return
+}
+
+// CompactAll compacts the whole keyspace to reclaim the space of deleted and overwritten
+// keys, reporting the duration and the approximate table size before and after.
+func (db *DB) CompactAll() (CompactResult, error) {
+	var res CompactResult
+	// every sharon key starts with a prefix byte below 0xff
+	all := []util.Range{{Limit: []byte{0xff}}}
+	sizes, err := db.SizeOf(all)
+	if err != nil {
+		return res, err
+	}
+	res.SizeBefore = sizes.Sum()
+
+	start := time.Now()
+	if err = db.CompactRange(util.Range{}); err != nil {
+		return res, err
+	}
+	res.Duration = time.Since(start)
+
+	if sizes, err = db.SizeOf(all); err != nil {
+		return res, err
+	}
+	res.SizeAfter = sizes.Sum()
+	return res, nil
+}
+
+// OpenOrCreate is like Open and also reports whether dbPath did not exist before, to tell
+// a first run that needs seeding from reopening an existing DB.
+func OpenOrCreate(dbPath string, o *opt.Options) (db *DB, created bool, err error) {
+	if _, err = os.Stat(dbPath); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, false, err
 		}
+		created = true
 	}
+	if db, err = Open(dbPath, o); err != nil {
+		return nil, false, err
+	}
+	return db, created, nil
+}
 
-	return &DB{database}, nil
+// OpenSub creates/opens the DB named name under the root directory, creating root if needed.
+func OpenSub(root, name string, o *opt.Options) (*DB, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return Open(filepath.Join(root, name), o)
 }
 
-// Close closes the DB.
+// Close stops the background goroutines, waits for them and closes the DB.
 func (db *DB) Close() error {
+	db.stop()
+	db.wg.Wait()
+	db.runOnClose()
 	return db.DB.Close()
 }
 
+// CloseWithTimeout is like Close but waits at most d for the background goroutines,
+// the DB is closed either way and ErrCloseTimeout is returned if they did not finish.
+func (db *DB) CloseWithTimeout(d time.Duration) error {
+	db.stop()
+	done := make(chan struct{})
+	go func() {
+		db.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-done:
+		db.runOnClose()
+		return db.DB.Close()
+	case <-timer.C:
+		db.runOnClose()
+		_ = db.DB.Close()
+		return ErrCloseTimeout
+	}
+}
+
+// OnClose registers fn to run when the DB is closed, after the background goroutines stopped
+// and before leveldb is closed. Callbacks run once, the last registered first.
+func (db *DB) OnClose(fn func()) {
+	db.closeMu.Lock()
+	defer db.closeMu.Unlock()
+	db.onClose = append(db.onClose, fn)
+}
+
+func (db *DB) runOnClose() {
+	db.closeMu.Lock()
+	fns := db.onClose
+	db.onClose = nil
+	db.closeMu.Unlock()
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i]()
+	}
+}
+
+// Go runs fn in a background goroutine tied to the DB lifetime, quit is closed
+// when the DB is closing and fn should return promptly after that.
+func (db *DB) Go(fn func(quit <-chan struct{})) {
+	db.wg.Add(1)
+	go func() {
+		defer db.wg.Done()
+		fn(db.quit)
+	}()
+}
+
+func (db *DB) stop() {
+	db.quitOnce.Do(func() {
+		close(db.quit)
+	})
+}
+
+// lockKey locks the stripe guarding realKey and returns its unlock function,
+// it serializes read-modify-write methods within this process.
+func (db *DB) lockKey(realKey []byte) func() {
+	m := &db.locks[lockStripe(realKey)]
+	m.Lock()
+	return m.Unlock
+}
+
+// lockKeys is like lockKey for several keys, stripes are locked in order to avoid deadlocks.
+func (db *DB) lockKeys(realKeys ...[]byte) func() {
+	return lockStriped(&db.locks, realKeys)
+}
+
+func lockStriped(locks *[lockStripes]sync.Mutex, realKeys [][]byte) func() {
+	stripes := make([]int, 0, len(realKeys))
+	for _, realKey := range realKeys {
+		stripes = append(stripes, lockStripe(realKey))
+	}
+	slices.Sort(stripes)
+	stripes = slices.Compact(stripes)
+	for _, i := range stripes {
+		locks[i].Lock()
+	}
+	return func() {
+		for _, i := range stripes {
+			locks[i].Unlock()
+		}
+	}
+}
+
+// nextSeq returns a sequence that increases across calls and restarts.
+func (db *DB) nextSeq() uint64 {
+	for {
+		last := db.seq.Load()
+		seq := deadlineNano(time.Now())
+		if seq <= last {
+			seq = last + 1
+		}
+		if db.seq.CompareAndSwap(last, seq) {
+			return seq
+		}
+	}
+}
+
+func lockStripe(realKey []byte) int {
+	h := uint32(2166136261)
+	for _, c := range realKey {
+		h = (h ^ uint32(c)) * 16777619
+	}
+	return int(h % lockStripes)
+}
+
+// SetBatchSink sets fn to be called with the dump of every batch successfully written
+// by the DB methods, e.g. to replicate it with ApplyBatchDump. It must be set before
+// the DB is used concurrently.
+func (db *DB) SetBatchSink(fn func(batchDump []byte)) {
+	db.batchSink = fn
+}
+
+// ApplyBatchDump writes a batch dump captured by a batch sink.
+func (db *DB) ApplyBatchDump(b []byte) error {
+	batch := new(leveldb.Batch)
+	if err := batch.Load(b); err != nil {
+		return err
+	}
+	return db.write(batch)
+}
+
+func (db *DB) write(batch *leveldb.Batch) error {
+	return db.writeIf(batch, nil)
+}
+
+// writeIf writes batch like write if check, run with every other write held off until batch
+// is committed, returns nil. A nil check always passes and does not hold off other writes.
+func (db *DB) writeIf(batch *leveldb.Batch, check func() error) error {
+	if db.strictNames {
+		if err := checkNames(batch); err != nil {
+			return err
+		}
+	}
+	if db.lruUsed.Load() {
+		unlock, err := db.forgetLRU(batch)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	if db.zsetChampion {
+		unlock, err := db.invalidateChampions(batch)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	if db.mergeUsed.Load() {
+		if err := db.clearMergeDeltas(batch); err != nil {
+			return err
+		}
+	}
+	if db.versionUsed.Load() {
+		unlock, err := db.stageVersions(batch)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	if db.bucketTracking {
+		unlock, err := db.trackBuckets(batch)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	if check == nil {
+		db.commitMu.RLock()
+		defer db.commitMu.RUnlock()
+	} else {
+		db.commitMu.Lock()
+		defer db.commitMu.Unlock()
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	if err := db.retry(func() error { return db.writeBatch(batch) }); err != nil {
+		return err
+	}
+	if db.batchSink != nil {
+		db.batchSink(batch.Dump())
+	}
+	return nil
+}
+
+// read gets the raw value of key, all hashmap point reads go through it.
+func (db *DB) read(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	if db.strictNames && emptyName(key) {
+		return nil, ErrEmptyName
+	}
+	if db.readFn != nil {
+		return db.readFn(key, ro)
+	}
+	return db.Get(key, ro)
+}
+
+func (db *DB) put(key, val []byte) error {
+	batch := new(leveldb.Batch)
+	batch.Put(key, val)
+	return db.write(batch)
+}
+
+func (db *DB) delete(key []byte) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(key)
+	return db.write(batch)
+}
+
+// Incr increment the number stored at key of the flat keyspace by step, keeping its deadline.
+// An expired key counts from 0 and loses its deadline.
+func (db *DB) Incr(key []byte, step int64) (uint64, error) {
+	realKey := Bconcat(flatPrefix, key)
+	defer db.lockKey(realKey)()
+
+	var oldNum uint64
+	var expired bool
+	val, err := db.Get(realKey, nil)
+	if err == nil {
+		if expired, err = db.expired(realKey); err != nil {
+			return 0, err
+		}
+		if !expired {
+			oldNum = BytesToUint64(val)
+		}
+	} else if err != errors.ErrNotFound {
+		return 0, err
+	}
+	newNum, err := incrBy(oldNum, step)
+	if err != nil {
+		return 0, err
+	}
+	batch := new(leveldb.Batch)
+	batch.Put(realKey, Uint64ToBytes(newNum))
+	if expired {
+		db.clearTTL(batch, realKey)
+	}
+	if err = db.write(batch); err != nil {
+		return 0, err
+	}
+	return newNum, nil
+}
+
+// GetInt get the number stored at key of the flat keyspace, 0 if it expired.
+func (db *DB) GetInt(key []byte) uint64 {
+	realKey := Bconcat(flatPrefix, key)
+	val, err := db.Get(realKey, nil)
+	if err != nil {
+		return 0
+	}
+	if expired, err := db.expired(realKey); err != nil || expired {
+		return 0
+	}
+	return BytesToUint64(val)
+}
+
 // Hset set the byte value in argument as value of the key of a hashmap.
 func (db *DB) Hset(name string, key, val []byte) error {
+	nameB := StringToBytesNoCopy(name)
+	realKey := Bconcat(hashPrefix, nameB, splitChar, key)
+	batch := new(leveldb.Batch)
+	batch.Put(realKey, db.encodeValue(val))
+	db.clearTTL(batch, realKey)
+	return db.write(batch)
+}
+
+// HsetReport set the value of the key of a hashmap like Hset, reporting whether the key was
+// created rather than overwritten, an expired key counts as created. The existence check and
+// the write are not atomic, concurrent writers of the same key may both report created.
+func (db *DB) HsetReport(name string, key, val []byte) (created bool, err error) {
+	has, err := db.hhas(Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key))
+	if err != nil {
+		return false, err
+	}
+	if err = db.Hset(name, key, val); err != nil {
+		return false, err
+	}
+	return !has, nil
+}
+
+// HsetCapped set the value of the key of a hashmap, it returns ErrValueTooLarge
+// and writes nothing when val is longer than maxLen.
+func (db *DB) HsetCapped(name string, key, val []byte, maxLen int) error {
+	if len(val) > maxLen {
+		return ErrValueTooLarge
+	}
+	return db.Hset(name, key, val)
+}
+
+// HsetTruncated set the value of the key of a hashmap, keeping at most the first maxLen bytes of val.
+func (db *DB) HsetTruncated(name string, key, val []byte, maxLen int) error {
+	if len(val) > maxLen {
+		val = val[:max(maxLen, 0)]
+	}
+	return db.Hset(name, key, val)
+}
+
+// Hreplace set the value of the key of a hashmap only if the key already exists.
+// The existence check and the write are not atomic against writers using other methods.
+func (db *DB) Hreplace(name string, key, val []byte) (replaced bool, err error) {
 	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
-	return db.Put(realKey, val, nil)
+	defer db.lockKey(realKey)()
+
+	has, err := db.hhas(realKey)
+	if err != nil || !has {
+		return false, err
+	}
+	if err = db.put(realKey, db.encodeValue(val)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Hduplicate copy the value of srcKey of a hashmap to dstKey. It returns false without writing
+// if srcKey does not exist, or if dstKey exists and overwrite is false.
+func (db *DB) Hduplicate(name string, srcKey, dstKey []byte, overwrite bool) (bool, error) {
+	nameB := StringToBytesNoCopy(name)
+	srcReal := Bconcat(hashPrefix, nameB, splitChar, srcKey)
+	dstReal := Bconcat(hashPrefix, nameB, splitChar, dstKey)
+	defer db.lockKeys(srcReal, dstReal)()
+
+	val, err := db.hget(srcReal)
+	if err == errors.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !overwrite {
+		has, err := db.hhas(dstReal)
+		if err != nil || has {
+			return false, err
+		}
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(dstReal, db.encodeValue(val))
+	db.clearTTL(batch, dstReal)
+	if err = db.write(batch); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // Hget get the value related to the specified key of a hashmap.
@@ -83,7 +690,7 @@ func (db *DB) Hget(name string, key []byte) *Reply {
 		Data:  []BS{},
 	}
 	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
-	val, err := db.Get(realKey, nil)
+	val, err := db.hget(realKey)
 	if err != nil {
 		r.State = err.Error()
 		return r
@@ -93,17 +700,65 @@ func (db *DB) Hget(name string, key []byte) *Reply {
 	return r
 }
 
+// HgetStrict is like Hget but verifies the block checksums of the read and fails on any
+// corruption it meets. It trades read speed for integrity, so suits critical hashmaps
+// rather than hot caches.
+func (db *DB) HgetStrict(name string, key []byte) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
+	val, err := db.hgetWith(realKey, &opt.ReadOptions{Strict: opt.StrictAll})
+	if err != nil {
+		r.State = err.Error()
+		return r
+	}
+	r.State = replyOK
+	r.Data = append(r.Data, val)
+	return r
+}
+
+// HgetDefault get the value related to the specified key of a hashmap, or def if the key does not exist.
+func (db *DB) HgetDefault(name string, key, def []byte) []byte {
+	val, err := db.hget(Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key))
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+// HgetContext is like Hget but gives up when ctx is done, the reply state is then the context error.
+// leveldb reads can not be canceled, so the read keeps running in the background until it completes.
+func (db *DB) HgetContext(ctx context.Context, name string, key []byte) *Reply {
+	if err := ctx.Err(); err != nil {
+		return &Reply{State: err.Error(), Data: []BS{}}
+	}
+	done := make(chan *Reply, 1)
+	go func() {
+		done <- db.Hget(name, key)
+	}()
+	select {
+	case r := <-done:
+		return r
+	case <-ctx.Done():
+		return &Reply{State: ctx.Err().Error(), Data: []BS{}}
+	}
+}
+
 // Hmset set multiple key-value pairs of a hashmap in one method call.
 func (db *DB) Hmset(name string, kvs ...[]byte) error {
 	if len(kvs) == 0 || len(kvs)%2 != 0 {
-		return errors.New("kvs len must is an even number")
+		return ErrOddKVCount
 	}
 	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
 	batch := new(leveldb.Batch)
 	for i := 0; i < (len(kvs) - 1); i += 2 {
-		batch.Put(Bconcat(keyPrefix, kvs[i]), kvs[i+1])
+		realKey := Bconcat(keyPrefix, kvs[i])
+		batch.Put(realKey, db.encodeValue(kvs[i+1]))
+		db.clearTTL(batch, realKey)
 	}
-	return db.Write(batch, nil)
+	return db.write(batch)
 }
 
 // Hmget get the values related to the specified multiple keys of a hashmap.
@@ -114,9 +769,24 @@ func (db *DB) Hmget(name string, keys [][]byte) *Reply {
 	}
 
 	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
+	// duplicate keys are read once, a nil value marks a missing key
+	seen := make(map[string][]byte, len(keys))
 	for _, key := range keys {
-		val, err := db.Get(Bconcat(keyPrefix, key), nil)
-		if err != nil {
+		val, ok := seen[string(key)]
+		if !ok {
+			var err error
+			val, err = db.hget(Bconcat(keyPrefix, key))
+			if err != nil && err != errors.ErrNotFound {
+				r.State = err.Error()
+				r.Data = []BS{}
+				return r
+			}
+			if err == nil && val == nil {
+				val = []byte{}
+			}
+			seen[string(key)] = val
+		}
+		if val == nil {
 			continue
 		}
 		r.Data = append(r.Data, key, val)
@@ -128,29 +798,46 @@ func (db *DB) Hmget(name string, keys [][]byte) *Reply {
 }
 
 // Hincr increment the number stored at key in a hashmap by step.
+// A step of 0 returns the current number without writing.
 func (db *DB) Hincr(name string, key []byte, step int64) (newNum uint64, err error) {
+	_, newNum, err = db.HincrEx(name, key, step)
+	return
+}
+
+// HincrEx increment the number stored at key in a hashmap by step, returns the number before and after the increment.
+func (db *DB) HincrEx(name string, key []byte, step int64) (oldNum, newNum uint64, err error) {
+	return db.hincr(name, key, step, 0)
+}
+
+// HincrFrom increment the number stored at key in a hashmap by step, a missing key starts from initial instead of 0.
+func (db *DB) HincrFrom(name string, key []byte, step int64, initial uint64) (uint64, error) {
+	_, newNum, err := db.hincr(name, key, step, initial)
+	return newNum, err
+}
+
+func (db *DB) hincr(name string, key []byte, step int64, initial uint64) (oldNum, newNum uint64, err error) {
 	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
-	var oldNum uint64
+	batch := new(leveldb.Batch)
 	var val []byte
-	val, err = db.Get(realKey, nil)
+	val, err = db.hget(realKey)
 	if err == nil {
 		oldNum = BytesToUint64(val)
-	}
-	if step > 0 {
-		if (scoreMax - uint64(step)) < oldNum {
-			err = errors.New("overflow number")
-			return
-		}
-		newNum = oldNum + uint64(step)
+	} else if err == errors.ErrNotFound {
+		oldNum = initial
+		// a fresh key must not inherit the ttl of an expired one
+		db.clearTTL(batch, realKey)
 	} else {
-		if uint64(-step) > oldNum {
-			err = errors.New("overflow number")
-			return
-		}
-		newNum = oldNum - uint64(-step)
+		return
+	}
+	if step == 0 {
+		return oldNum, oldNum, nil
+	}
+	if newNum, err = incrBy(oldNum, step); err != nil {
+		return
 	}
 
-	err = db.Put(realKey, Uint64ToBytes(newNum), nil)
+	batch.Put(realKey, db.encodeValue(Uint64ToBytes(newNum)))
+	err = db.write(batch)
 	if err != nil {
 		newNum = 0
 		return
@@ -158,10 +845,73 @@ func (db *DB) Hincr(name string, key []byte, step int64) (newNum uint64, err err
 	return
 }
 
+// HlogAppend append val to the log of the key of a hashmap, returns its sequence number.
+// Log entries are stored under key+splitChar+seq in the same hashmap.
+func (db *DB) HlogAppend(name string, key, val []byte) (seq uint64, err error) {
+	logPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key, splitChar)
+	defer db.lockKey(logPrefix)()
+
+	iter := db.newIterator(util.BytesPrefix(logPrefix), nil)
+	if iter.Last() {
+		seq = BytesToUint64(iter.Key()[len(logPrefix):])
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return 0, err
+	}
+
+	seq++
+	if err = db.put(Bconcat(logPrefix, Uint64ToBytes(seq)), db.encodeValue(val)); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// HlogRange list seq-value pairs of the log of the key of a hashmap in sequence order.
+func (db *DB) HlogRange(name string, key []byte, limit int) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	logPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key, splitChar)
+	n, size := 0, 0
+	iter := db.newIterator(util.BytesPrefix(logPrefix), nil)
+	for iter.Next() {
+		val, err := db.decodeValue(append([]byte{}, iter.Value()...))
+		if err != nil {
+			iter.Release()
+			r.State = err.Error()
+			r.Data = []BS{}
+			return r
+		}
+		r.Data = append(r.Data, append([]byte{}, iter.Key()[len(logPrefix):]...), val)
+		if db.replyFull(r, &size) {
+			iter.Release()
+			return r
+		}
+		n++
+		if n == limit {
+			break
+		}
+	}
+
+	iter.Release()
+	err := iter.Error()
+	if err != nil {
+		r.State = err.Error()
+		r.Data = []BS{}
+		return r
+	}
+	if n > 0 {
+		r.State = replyOK
+	}
+	return r
+}
+
 // HgetInt get the value related to the specified key of a hashmap.
 func (db *DB) HgetInt(name string, key []byte) uint64 {
 	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
-	val, err := db.Get(realKey, nil)
+	val, err := db.hget(realKey)
 	if err != nil {
 		return 0
 	}
@@ -170,16 +920,35 @@ func (db *DB) HgetInt(name string, key []byte) uint64 {
 
 func (db *DB) HhasKey(name string, key []byte) bool {
 	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
-	has, err := db.Has(realKey, nil)
+	has, err := db.hhas(realKey)
 	if err != nil {
 		return false
 	}
 	return has
 }
 
+// Hmexists reports for each of the specified keys whether it exists in a hashmap, aligned to keys.
+func (db *DB) Hmexists(name string, keys [][]byte) ([]bool, error) {
+	exists := make([]bool, len(keys))
+	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
+	for i, key := range keys {
+		has, err := db.hhas(Bconcat(keyPrefix, key))
+		if err != nil {
+			return nil, err
+		}
+		exists[i] = has
+	}
+	return exists, nil
+}
+
 // Hdel delete specified key of a hashmap.
 func (db *DB) Hdel(name string, key []byte) error {
-	return db.Delete(Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key), nil)
+	nameB := StringToBytesNoCopy(name)
+	realKey := Bconcat(hashPrefix, nameB, splitChar, key)
+	batch := new(leveldb.Batch)
+	batch.Delete(realKey)
+	db.clearTTL(batch, realKey)
+	return db.write(batch)
 }
 
 // Hmdel delete specified multiple keys of a hashmap.
@@ -187,49 +956,477 @@ func (db *DB) Hmdel(name string, keys [][]byte) error {
 	batch := new(leveldb.Batch)
 	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
 	for _, key := range keys {
-		batch.Delete(Bconcat(keyPrefix, key))
+		realKey := Bconcat(keyPrefix, key)
+		batch.Delete(realKey)
+		db.clearTTL(batch, realKey)
+	}
+	return db.write(batch)
+}
+
+// HmdelCount delete specified multiple keys of a hashmap, returns how many of them existed.
+func (db *DB) HmdelCount(name string, keys [][]byte) (deleted int, err error) {
+	batch := new(leveldb.Batch)
+	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
+	seen := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[string(key)]; ok {
+			continue
+		}
+		seen[string(key)] = struct{}{}
+		realKey := Bconcat(keyPrefix, key)
+		has, err := db.hhas(realKey)
+		if err != nil {
+			return 0, err
+		}
+		if has {
+			batch.Delete(realKey)
+			db.clearTTL(batch, realKey)
+			deleted++
+		}
 	}
-	return db.Write(batch, nil)
+	if deleted == 0 {
+		return 0, nil
+	}
+	if err = db.write(batch); err != nil {
+		return 0, err
+	}
+	return deleted, nil
 }
 
 // HdelBucket delete all keys in a hashmap.
 func (db *DB) HdelBucket(name string) error {
+	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
 	batch := new(leveldb.Batch)
-	iter := db.NewIterator(util.BytesPrefix(Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)), nil)
+	iter := db.newIterator(util.BytesPrefix(keyPrefix), nil)
 	for iter.Next() {
 		batch.Delete(iter.Key())
+		db.clearTTL(batch, iter.Key())
 	}
 	iter.Release()
 	err := iter.Error()
 	if err != nil {
 		return err
 	}
-	return db.Write(batch, nil)
+	if err = db.clearMergeDeltasUnder(batch, keyPrefix); err != nil {
+		return err
+	}
+	return db.write(batch)
+}
+
+// HsetBucketAtomic replace all keys of a hashmap with kv in a single batch, so readers see
+// either the old or the new content. The batch holds a delete for every old key and all of
+// kv, so it needs memory in proportion to both for large hashmaps.
+func (db *DB) HsetBucketAtomic(name string, kv map[string][]byte) error {
+	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
+	batch := new(leveldb.Batch)
+	iter := db.newIterator(util.BytesPrefix(keyPrefix), nil)
+	for iter.Next() {
+		if _, ok := kv[string(iter.Key()[len(keyPrefix):])]; !ok {
+			batch.Delete(iter.Key())
+		}
+		db.clearTTL(batch, iter.Key())
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	for key, val := range kv {
+		batch.Put(Bconcat(keyPrefix, []byte(key)), db.encodeValue(val))
+	}
+	return db.write(batch)
+}
+
+// HdelBucketCtx delete all keys in a hashmap in chunks, checking ctx between chunks.
+// progress, if not nil, is called with the running total after each chunk.
+// It returns the number of keys deleted, along with ctx.Err() when canceled.
+func (db *DB) HdelBucketCtx(ctx context.Context, name string, progress func(deleted int64)) (int64, error) {
+	keyRange := util.BytesPrefix(Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar))
+	var deleted int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+
+		batch := new(leveldb.Batch)
+		n := 0
+		iter := db.newIterator(keyRange, nil)
+		for n < deleteChunk && iter.Next() {
+			batch.Delete(iter.Key())
+			db.clearTTL(batch, iter.Key())
+			n++
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return deleted, err
+		}
+		if n == 0 {
+			return deleted, nil
+		}
+		if err := db.write(batch); err != nil {
+			return deleted, err
+		}
+		deleted += int64(n)
+		if progress != nil {
+			progress(deleted)
+		}
+	}
+}
+
+// SetMaxReplyBytes caps the bytes of keys and values a scan collects into a reply. A scan
+// crossing it stops and returns the entries collected so far with the state
+// "reply size limit exceeded", ZpopMinN and ZpopMaxN only remove the members they return.
+// 0 means no cap, which is the default. It must be set before the DB is used concurrently.
+func (db *DB) SetMaxReplyBytes(n int) {
+	db.maxReplyBytes = n
+}
+
+// SetHgetallMax caps the number of keys Hgetall returns, n <= 0 restores the default of 100000.
+// It must be set before the DB is used concurrently.
+func (db *DB) SetHgetallMax(n int) {
+	db.hgetallMax = n
+}
+
+// Hgetall returns all the key-value pairs of a hashmap as a map. It fails with ErrBucketTooLarge
+// rather than loading a hashmap with more keys than the cap set by SetHgetallMax.
+func (db *DB) Hgetall(name string) (map[string][]byte, error) {
+	limit := db.hgetallMax
+	if limit <= 0 {
+		limit = hgetallMax
+	}
+	all := make(map[string][]byte)
+	var errTooLarge error
+	err := db.hscanEach(name, nil, func(key, val []byte) bool {
+		if len(all) == limit {
+			errTooLarge = ErrBucketTooLarge
+			return false
+		}
+		all[string(key)] = append([]byte{}, val...)
+		return true
+	})
+	if err == nil {
+		err = errTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// replyFull adds the last pair of r to size and, once size crosses the reply cap,
+// drops that pair and marks r as too large.
+func (db *DB) replyFull(r *Reply, size *int) bool {
+	return db.replyFullN(r, size, 2)
+}
+
+// replyFullN is replyFull for replies whose entries are n items long.
+func (db *DB) replyFullN(r *Reply, size *int, n int) bool {
+	if db.maxReplyBytes <= 0 {
+		return false
+	}
+	last := len(r.Data) - n
+	for _, item := range r.Data[last:] {
+		*size += len(item)
+	}
+	if *size <= db.maxReplyBytes {
+		return false
+	}
+	r.Data = r.Data[:last]
+	r.State = replyTooLarge
+	return true
 }
 
 // Hscan list key-value pairs of a hashmap with keys in range (key_start, key_end].
 func (db *DB) Hscan(name string, keyStart []byte, limit int) *Reply {
+	return db.hscan(name, keyStart, false, limit)
+}
+
+// HscanFrom list key-value pairs of a hashmap like Hscan, including the entry at keyStart when inclusive.
+func (db *DB) HscanFrom(name string, keyStart []byte, inclusive bool, limit int) *Reply {
+	return db.hscan(name, keyStart, inclusive, limit)
+}
+
+func (db *DB) hscan(name string, keyStart []byte, inclusive bool, limit int) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
+	realKey := Bconcat(keyPrefix, keyStart)
+	keyPrefixLen := len(keyPrefix)
+	n, size := 0, 0
+	sliceRange := util.BytesPrefix(keyPrefix)
+	if len(realKey) > keyPrefixLen {
+		sliceRange.Start = realKey
+	} else {
+		realKey = sliceRange.Start
+	}
+	iter := db.newIterator(sliceRange, nil)
+	for ok := iter.First(); ok; ok = iter.Next() {
+		if c := bytes.Compare(realKey, iter.Key()); c == -1 || (inclusive && c == 0) {
+			val, err := db.decodeValue(append([]byte{}, iter.Value()...))
+			if err != nil {
+				iter.Release()
+				r.State = err.Error()
+				r.Data = []BS{}
+				return r
+			}
+			r.Data = append(r.Data,
+				append([]byte{}, iter.Key()[keyPrefixLen:]...),
+				val,
+			)
+			if db.replyFull(r, &size) {
+				iter.Release()
+				return r
+			}
+			n++
+			if n == limit {
+				break
+			}
+		}
+	}
+
+	iter.Release()
+	err := iter.Error()
+	if err != nil {
+		r.State = err.Error()
+		r.Data = []BS{}
+		return r
+	}
+	if n > 0 {
+		r.State = replyOK
+	}
+	return r
+}
+
+// HscanFilter list key-value pairs of a hashmap like Hscan, keeping only the entries whose value matches pred.
+// Only matching entries count toward limit.
+func (db *DB) HscanFilter(name string, keyStart []byte, limit int, pred func(value []byte) bool) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	n, size := 0, 0
+	err := db.hscanEach(name, keyStart, func(key, val []byte) bool {
+		if !pred(val) {
+			return true
+		}
+		r.Data = append(r.Data, append([]byte{}, key...), append([]byte{}, val...))
+		if db.replyFull(r, &size) {
+			return false
+		}
+		n++
+		return n != limit
+	})
+	if err != nil {
+		r.State = err.Error()
+		r.Data = []BS{}
+		return r
+	}
+	if r.State == replyTooLarge {
+		return r
+	}
+	if n > 0 {
+		r.State = replyOK
+	}
+	return r
+}
+
+// HscanMap list key-value pairs of a hashmap like Hscan, storing in the reply what transform
+// returns for each entry. transform gets copies of the key and value, it may modify and return them.
+func (db *DB) HscanMap(name string, keyStart []byte, limit int, transform func(key, value []byte) (BS, BS)) *Reply {
 	r := &Reply{
 		State: replyError,
 		Data:  []BS{},
 	}
+	n, size := 0, 0
+	err := db.hscanEach(name, keyStart, func(key, val []byte) bool {
+		k, v := transform(append([]byte{}, key...), append([]byte{}, val...))
+		r.Data = append(r.Data, k, v)
+		if db.replyFull(r, &size) {
+			return false
+		}
+		n++
+		return n != limit
+	})
+	if err != nil {
+		r.State = err.Error()
+		r.Data = []BS{}
+		return r
+	}
+	if r.State == replyTooLarge {
+		return r
+	}
+	if n > 0 {
+		r.State = replyOK
+	}
+	return r
+}
+
+// HscanLargeValues list up to limit key-value pairs of a hashmap whose value is at least minSize bytes long,
+// to find the entries bloating a hashmap. Only the matching entries are copied.
+func (db *DB) HscanLargeValues(name string, minSize int, limit int) *Reply {
+	return db.HscanFilter(name, nil, limit, func(value []byte) bool {
+		return len(value) >= minSize
+	})
+}
+
+// hscanEach iterates the entries of a hashmap with keys after keyStart and calls fn with
+// the key and the decoded value, both only valid during the call. It stops when fn returns false.
+func (db *DB) hscanEach(name string, keyStart []byte, fn func(key, val []byte) bool) error {
 	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
 	realKey := Bconcat(keyPrefix, keyStart)
 	keyPrefixLen := len(keyPrefix)
-	n := 0
 	sliceRange := util.BytesPrefix(keyPrefix)
 	if len(realKey) > keyPrefixLen {
 		sliceRange.Start = realKey
 	} else {
 		realKey = sliceRange.Start
 	}
-	iter := db.NewIterator(sliceRange, nil)
+	iter := db.newIterator(sliceRange, nil)
+	defer iter.Release()
 	for ok := iter.First(); ok; ok = iter.Next() {
 		if bytes.Compare(realKey, iter.Key()) == -1 {
+			val, err := db.decodeValue(iter.Value())
+			if err != nil {
+				return err
+			}
+			if !fn(iter.Key()[keyPrefixLen:], val) {
+				break
+			}
+		}
+	}
+	return iter.Error()
+}
+
+// HscanChan streams the entries of a hashmap after keyStart over a channel buffering bufSize
+// entries. The channel is closed when the scan ends, fails, or is stopped by the returned
+// cancel func, which releases the iterator before returning and may be called more than once.
+func (db *DB) HscanChan(name string, keyStart []byte, bufSize int) (<-chan Entry, func()) {
+	ch := make(chan Entry, bufSize)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	db.Go(func(quit <-chan struct{}) {
+		defer close(stopped)
+		defer close(ch)
+		_ = db.hscanEach(name, keyStart, func(key, val []byte) bool {
+			select {
+			case ch <- Entry{Key: append([]byte{}, key...), Value: append([]byte{}, val...)}:
+				return true
+			case <-done:
+				return false
+			case <-quit:
+				return false
+			}
+		})
+	})
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(done)
+		})
+		<-stopped
+	}
+}
+
+// HscanIntKeys returns up to limit entries of a hashmap from startKey on, for hashmaps keyed
+// by Uint64ToBytes. Keys that are not exactly 8 bytes long are skipped.
+func (db *DB) HscanIntKeys(name string, startKey uint64, limit int) ([]struct {
+	Key   uint64
+	Value []byte
+}, error) {
+	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
+	sliceRange := util.BytesPrefix(keyPrefix)
+	sliceRange.Start = Bconcat(keyPrefix, Uint64ToBytes(startKey))
+
+	var entries []struct {
+		Key   uint64
+		Value []byte
+	}
+	iter := db.newIterator(sliceRange, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()[len(keyPrefix):]
+		if len(key) != 8 {
+			continue
+		}
+		val, err := db.decodeValue(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, struct {
+			Key   uint64
+			Value []byte
+		}{Key: BytesToUint64(key), Value: append([]byte{}, val...)})
+		if len(entries) == limit {
+			break
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// HscanNumeric returns up to limit entries of a hashmap after keyStart with their values
+// decoded as Uint64ToBytes counters, like those of Hincr. Values that are not exactly
+// 8 bytes long are skipped and do not count toward limit.
+func (db *DB) HscanNumeric(name string, keyStart []byte, limit int) ([]struct {
+	Key   string
+	Value uint64
+}, error) {
+	var entries []struct {
+		Key   string
+		Value uint64
+	}
+	err := db.hscanEach(name, keyStart, func(key, val []byte) bool {
+		if len(val) != 8 {
+			return true
+		}
+		entries = append(entries, struct {
+			Key   string
+			Value uint64
+		}{Key: string(key), Value: BytesToUint64(val)})
+		return len(entries) != limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (db *DB) Hprefix(name string, prefix []byte, limit int) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, prefix) // keyPrefix
+	keyPrefixLen := len(realKey)
+	n, size := 0, 0
+	sliceRange := util.BytesPrefix(realKey)
+	if len(realKey) > keyPrefixLen {
+		sliceRange.Start = realKey
+	} else {
+		realKey = sliceRange.Start
+	}
+	iter := db.newIterator(sliceRange, nil)
+	for ok := iter.First(); ok; ok = iter.Next() {
+		if bytes.Compare(realKey, iter.Key()) == -1 {
+			val, err := db.decodeValue(append([]byte{}, iter.Value()...))
+			if err != nil {
+				iter.Release()
+				r.State = err.Error()
+				r.Data = []BS{}
+				return r
+			}
 			r.Data = append(r.Data,
 				append([]byte{}, iter.Key()[keyPrefixLen:]...),
-				append([]byte{}, iter.Value()...),
+				val,
 			)
+			if db.replyFull(r, &size) {
+				iter.Release()
+				return r
+			}
 			n++
 			if n == limit {
 				break
@@ -250,31 +1447,43 @@ func (db *DB) Hscan(name string, keyStart []byte, limit int) *Reply {
 	return r
 }
 
-func (db *DB) Hprefix(name string, prefix []byte, limit int) *Reply {
+// Hchildren list the distinct next-level segments of the keys under path in a hashmap,
+// where segments are separated by sep, like listing the entries of a directory.
+func (db *DB) Hchildren(name string, path []byte, sep byte, limit int) *Reply {
 	r := &Reply{
 		State: replyError,
 		Data:  []BS{},
 	}
-	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, prefix) // keyPrefix
-	keyPrefixLen := len(realKey)
-	n := 0
-	sliceRange := util.BytesPrefix(realKey)
-	if len(realKey) > keyPrefixLen {
-		sliceRange.Start = realKey
-	} else {
-		realKey = sliceRange.Start
-	}
-	iter := db.NewIterator(sliceRange, nil)
-	for ok := iter.First(); ok; ok = iter.Next() {
-		if bytes.Compare(realKey, iter.Key()) == -1 {
-			r.Data = append(r.Data,
-				append([]byte{}, iter.Key()[keyPrefixLen:]...),
-				append([]byte{}, iter.Value()...),
-			)
-			n++
-			if n == limit {
-				break
-			}
+	pathPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, path)
+	n, size := 0, 0
+	seen := map[string]struct{}{}
+	iter := db.newIterator(util.BytesPrefix(pathPrefix), nil)
+	for ok := iter.First(); ok; {
+		rest := iter.Key()[len(pathPrefix):]
+		i := bytes.IndexByte(rest, sep)
+		if i < 0 {
+			i = len(rest)
+		}
+		child := append([]byte{}, rest[:i]...)
+		if i < len(rest) {
+			// skip the whole subtree of child
+			next := util.BytesPrefix(Bconcat(pathPrefix, child, []byte{sep})).Limit
+			ok = next != nil && iter.Seek(next)
+		} else {
+			ok = iter.Next()
+		}
+		if _, dup := seen[string(child)]; dup {
+			continue
+		}
+		seen[string(child)] = struct{}{}
+		r.Data = append(r.Data, child)
+		if db.replyFullN(r, &size, 1) {
+			iter.Release()
+			return r
+		}
+		n++
+		if n == limit {
+			break
 		}
 	}
 
@@ -291,6 +1500,38 @@ func (db *DB) Hprefix(name string, prefix []byte, limit int) *Reply {
 	return r
 }
 
+// Haggregate computes sum, min, max and count over the values of a hashmap read as uint64.
+// Values shorter than 8 bytes are not numbers and are skipped, count only includes numeric values.
+func (db *DB) Haggregate(name string) (sum, min, max uint64, count int64, err error) {
+	iter := db.newIterator(util.BytesPrefix(Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		val, err := db.decodeValue(iter.Value())
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+		if len(val) < 8 {
+			continue
+		}
+		num := BytesToUint64(val)
+		if scoreMax-sum < num {
+			return 0, 0, 0, 0, errors.New("overflow number")
+		}
+		sum += num
+		if count == 0 || num < min {
+			min = num
+		}
+		if num > max {
+			max = num
+		}
+		count++
+	}
+	if err = iter.Error(); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return sum, min, max, count, nil
+}
+
 // Hrscan list key-value pairs of a hashmap with keys in range (key_start, key_end], in reverse order.
 func (db *DB) Hrscan(name string, keyStart []byte, limit int) *Reply {
 	r := &Reply{
@@ -300,19 +1541,30 @@ func (db *DB) Hrscan(name string, keyStart []byte, limit int) *Reply {
 	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
 	realKey := Bconcat(keyPrefix, keyStart)
 	keyPrefixLen := len(keyPrefix)
-	n := 0
+	n, size := 0, 0
 	sliceRange := util.BytesPrefix(keyPrefix)
 	if len(realKey) > keyPrefixLen {
 		sliceRange.Limit = realKey
 	} else {
 		realKey = sliceRange.Limit
 	}
-	iter := db.NewIterator(sliceRange, nil)
+	iter := db.newIterator(sliceRange, nil)
 	for ok := iter.Last(); ok; ok = iter.Prev() {
+		val, err := db.decodeValue(append([]byte{}, iter.Value()...))
+		if err != nil {
+			iter.Release()
+			r.State = err.Error()
+			r.Data = []BS{}
+			return r
+		}
 		r.Data = append(r.Data,
 			append([]byte{}, iter.Key()[keyPrefixLen:]...),
-			append([]byte{}, iter.Value()...),
+			val,
 		)
+		if db.replyFull(r, &size) {
+			iter.Release()
+			return r
+		}
 		n++
 		if n == limit {
 			break
@@ -332,6 +1584,41 @@ func (db *DB) Hrscan(name string, keyStart []byte, limit int) *Reply {
 	return r
 }
 
+// HscanDebug list entries of a hashmap like Hscan, along with the full leveldb key of each entry.
+// Values are returned as stored, without the value codec applied. Like HscanIntKeys and
+// HscanNumeric, it returns a nil list with the error of a failed read.
+func (db *DB) HscanDebug(name string, keyStart []byte, limit int) ([]HDebugEntry, error) {
+	list := []HDebugEntry{}
+	keyPrefix := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar)
+	realKey := Bconcat(keyPrefix, keyStart)
+	keyPrefixLen := len(keyPrefix)
+	sliceRange := util.BytesPrefix(keyPrefix)
+	if len(realKey) > keyPrefixLen {
+		sliceRange.Start = realKey
+	} else {
+		realKey = sliceRange.Start
+	}
+	iter := db.newIterator(sliceRange, nil)
+	for ok := iter.First(); ok; ok = iter.Next() {
+		if bytes.Compare(realKey, iter.Key()) == -1 {
+			rawKey := append([]byte{}, iter.Key()...)
+			list = append(list, HDebugEntry{
+				Key:    rawKey[keyPrefixLen:],
+				RawKey: rawKey,
+				Value:  append([]byte{}, iter.Value()...),
+			})
+			if len(list) == limit {
+				break
+			}
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
 // Zset set the score of the key of a zset.
 func (db *DB) Zset(name string, key []byte, val uint64) error {
 	nameB := StringToBytesNoCopy(name)
@@ -339,23 +1626,128 @@ func (db *DB) Zset(name string, key []byte, val uint64) error {
 	keyScore := Bconcat(zetScorePrefix, nameB, splitChar, key)                    // key / score
 	newScoreKey := Bconcat(zetKeyPrefix, nameB, splitChar, score, splitChar, key) // name+score+key / nil
 
-	oldScore, _ := db.Get(keyScore, nil)
+	if db.zsetChampion {
+		defer db.lockChampions(nameB)()
+	}
+	oldScore, err := db.getRaw(keyScore)
+	if err != nil {
+		return err
+	}
 	if !bytes.Equal(oldScore, score) {
 		batch := new(leveldb.Batch)
 		batch.Put(keyScore, score)
 		batch.Put(newScoreKey, nil)
 		batch.Delete(Bconcat(zetKeyPrefix, nameB, splitChar, oldScore, splitChar, key))
-		return db.Write(batch, nil)
+		if oldScore == nil && db.zsetInsertion {
+			db.stageZinsert(batch, nameB, key)
+		}
+		if db.zsetChampion {
+			if err := db.stageChampion(batch, nameB, key, score); err != nil {
+				return err
+			}
+		}
+		return db.write(batch)
+	}
+	return nil
+}
+
+// ZsetReport set the score of the key of a zset like Zset, reporting whether the key
+// existed and its previous score.
+func (db *DB) ZsetReport(name string, key []byte, score uint64) (existed bool, oldScore uint64, err error) {
+	nameB := StringToBytesNoCopy(name)
+	defer db.lockKey(Bconcat(zetScorePrefix, nameB, splitChar, key))()
+
+	batch := new(leveldb.Batch)
+	oldScoreB, err := db.stageZset(batch, nameB, key, Uint64ToBytes(score))
+	if err != nil {
+		return false, 0, err
+	}
+	if err = db.write(batch); err != nil {
+		return false, 0, err
+	}
+	if oldScoreB == nil {
+		return false, 0, nil
+	}
+	return true, BytesToUint64(oldScoreB), nil
+}
+
+// ZincrGC increment the number stored at key in a zset by step like Zincr, but removes the key
+// from both indexes when the result is 0, like a reference count. removed reports whether it did.
+func (db *DB) ZincrGC(name string, key []byte, step int64) (newScore uint64, removed bool, err error) {
+	nameB := StringToBytesNoCopy(name)
+	keyScore := Bconcat(zetScorePrefix, nameB, splitChar, key)
+	defer db.lockKey(keyScore)()
+
+	oldScoreB, err := db.getRaw(keyScore)
+	if err != nil {
+		return 0, false, err
+	}
+	if newScore, err = incrBy(BytesToUint64(oldScoreB), step); err != nil {
+		return 0, false, err
+	}
+
+	batch := new(leveldb.Batch)
+	if newScore == 0 {
+		if oldScoreB == nil {
+			return 0, false, nil
+		}
+		if err = db.stageZdel(batch, nameB, key, oldScoreB); err != nil {
+			return 0, false, err
+		}
+		removed = true
+	} else if _, err = db.stageZset(batch, nameB, key, Uint64ToBytes(newScore)); err != nil {
+		return 0, false, err
+	}
+	if err = db.write(batch); err != nil {
+		return 0, false, err
+	}
+	return newScore, removed, nil
+}
+
+// stageZset stages setting the score of the key of a zset into batch, keeping both indexes consistent.
+// It returns the previous score, nil if the key did not exist, nothing is staged if the score is unchanged.
+// A new key is recorded in the insertion order.
+func (db *DB) stageZset(batch *leveldb.Batch, nameB, key, score []byte) (oldScore []byte, err error) {
+	keyScore := Bconcat(zetScorePrefix, nameB, splitChar, key)
+	if oldScore, err = db.getRaw(keyScore); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(oldScore, score) {
+		return oldScore, nil
+	}
+	batch.Put(keyScore, score)
+	batch.Put(Bconcat(zetKeyPrefix, nameB, splitChar, score, splitChar, key), nil)
+	if oldScore != nil {
+		batch.Delete(Bconcat(zetKeyPrefix, nameB, splitChar, oldScore, splitChar, key))
+	} else if db.zsetInsertion {
+		db.stageZinsert(batch, nameB, key)
+	}
+	return oldScore, nil
+}
+
+// stageZdel stages deleting the key with score of a zset into batch, with its insertion order.
+func (db *DB) stageZdel(batch *leveldb.Batch, nameB, key, score []byte) error {
+	batch.Delete(Bconcat(zetScorePrefix, nameB, splitChar, key))
+	batch.Delete(Bconcat(zetKeyPrefix, nameB, splitChar, score, splitChar, key))
+	if db.zsetInsertion {
+		return db.stageZuninsert(batch, nameB, key)
 	}
 	return nil
 }
 
 // Zincr increment the number stored at key in a zset by step.
+// A step of 0 returns the current score without writing.
 func (db *DB) Zincr(name string, key []byte, step int64) (uint64, error) {
 	nameB := StringToBytesNoCopy(name)
 	keyScore := Bconcat(zetScorePrefix, nameB, splitChar, key) // key / score
+	if db.zsetChampion {
+		defer db.lockChampions(nameB)()
+	}
 
-	score := db.Zget(name, key)       // get old score
+	score := db.Zget(name, key) // get old score
+	if step == 0 {
+		return score, nil
+	}
 	oldScoreB := Uint64ToBytes(score) // old score byte
 	if step > 0 {
 		if (scoreMax - uint64(step)) < score {
@@ -375,13 +1767,232 @@ func (db *DB) Zincr(name string, key []byte, step int64) (uint64, error) {
 	batch.Put(keyScore, newScoreB)
 	batch.Put(Bconcat(zetKeyPrefix, nameB, splitChar, newScoreB, splitChar, key), nil)
 	batch.Delete(Bconcat(zetKeyPrefix, nameB, splitChar, oldScoreB, splitChar, key))
-	err := db.Write(batch, nil)
+	if db.zsetInsertion {
+		if err := db.stageZinsertNew(batch, nameB, key); err != nil {
+			return 0, err
+		}
+	}
+	if db.zsetChampion {
+		if err := db.stageChampion(batch, nameB, key, newScoreB); err != nil {
+			return 0, err
+		}
+	}
+	err := db.write(batch)
+	if err != nil {
+		return 0, err
+	}
+	return score, nil
+}
+
+// ZincrExisting increment the number stored at key in a zset by step like Zincr, but returns
+// ErrNotFound instead of creating the key when it does not exist.
+func (db *DB) ZincrExisting(name string, key []byte, step int64) (uint64, error) {
+	nameB := StringToBytesNoCopy(name)
+	keyScore := Bconcat(zetScorePrefix, nameB, splitChar, key)
+	defer db.lockKey(keyScore)()
+
+	oldScoreB, err := db.Get(keyScore, nil)
+	if err != nil {
+		return 0, err
+	}
+	score, err := incrBy(BytesToUint64(oldScoreB), step)
+	if err != nil {
+		return 0, err
+	}
+	batch := new(leveldb.Batch)
+	if _, err = db.stageZset(batch, nameB, key, Uint64ToBytes(score)); err != nil {
+		return 0, err
+	}
+	if batch.Len() > 0 {
+		if err = db.write(batch); err != nil {
+			return 0, err
+		}
+	}
+	return score, nil
+}
+
+// ZincrClamp increment the number stored at key in a zset by step, clamping the result into [min, max].
+func (db *DB) ZincrClamp(name string, key []byte, step int64, min, max uint64) (uint64, error) {
+	if min > max {
+		return 0, errors.New("min is greater than max")
+	}
+	nameB := StringToBytesNoCopy(name)
+	keyScore := Bconcat(zetScorePrefix, nameB, splitChar, key) // key / score
+	defer db.lockKey(keyScore)()
+
+	score := db.Zget(name, key)
+	oldScoreB := Uint64ToBytes(score)
+	if step > 0 {
+		if (scoreMax - uint64(step)) < score {
+			score = scoreMax
+		} else {
+			score += uint64(step)
+		}
+	} else {
+		if uint64(-step) > score {
+			score = scoreMin
+		} else {
+			score -= uint64(-step)
+		}
+	}
+	if score < min {
+		score = min
+	} else if score > max {
+		score = max
+	}
+
+	newScoreB := Uint64ToBytes(score)
+
+	batch := new(leveldb.Batch)
+	batch.Put(keyScore, newScoreB)
+	batch.Put(Bconcat(zetKeyPrefix, nameB, splitChar, newScoreB, splitChar, key), nil)
+	if !bytes.Equal(oldScoreB, newScoreB) {
+		batch.Delete(Bconcat(zetKeyPrefix, nameB, splitChar, oldScoreB, splitChar, key))
+	}
+	if db.zsetInsertion {
+		if err := db.stageZinsertNew(batch, nameB, key); err != nil {
+			return 0, err
+		}
+	}
+	err := db.write(batch)
 	if err != nil {
 		return 0, err
 	}
 	return score, nil
 }
 
+// Zswap swap the scores of two keys of a zset in one batch, both keys must exist.
+func (db *DB) Zswap(name string, keyA, keyB []byte) error {
+	nameB := StringToBytesNoCopy(name)
+	keyScoreA := Bconcat(zetScorePrefix, nameB, splitChar, keyA)
+	keyScoreB := Bconcat(zetScorePrefix, nameB, splitChar, keyB)
+	defer db.lockKeys(keyScoreA, keyScoreB)()
+
+	scoreA, err := db.Get(keyScoreA, nil)
+	if err != nil {
+		return err
+	}
+	scoreB, err := db.Get(keyScoreB, nil)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(scoreA, scoreB) {
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(keyScoreA, scoreB)
+	batch.Put(keyScoreB, scoreA)
+	batch.Delete(Bconcat(zetKeyPrefix, nameB, splitChar, scoreA, splitChar, keyA))
+	batch.Delete(Bconcat(zetKeyPrefix, nameB, splitChar, scoreB, splitChar, keyB))
+	batch.Put(Bconcat(zetKeyPrefix, nameB, splitChar, scoreB, splitChar, keyA), nil)
+	batch.Put(Bconcat(zetKeyPrefix, nameB, splitChar, scoreA, splitChar, keyB), nil)
+	return db.write(batch)
+}
+
+// Ztransfer move amount from the score of from to the score of to of a zset in one batch.
+// from must exist and hold at least amount, otherwise ErrInsufficientScore is returned and
+// nothing changes, to is created if missing.
+func (db *DB) Ztransfer(name string, from, to []byte, amount uint64) error {
+	nameB := StringToBytesNoCopy(name)
+	keyScoreFrom := Bconcat(zetScorePrefix, nameB, splitChar, from)
+	keyScoreTo := Bconcat(zetScorePrefix, nameB, splitChar, to)
+	defer db.lockKeys(keyScoreFrom, keyScoreTo)()
+
+	fromScoreB, err := db.Get(keyScoreFrom, nil)
+	if err != nil {
+		return err
+	}
+	fromScore := BytesToUint64(fromScoreB)
+	if fromScore < amount {
+		return ErrInsufficientScore
+	}
+	if bytes.Equal(from, to) || amount == 0 {
+		return nil
+	}
+	toScoreB, err := db.Get(keyScoreTo, nil)
+	if err != nil && err != errors.ErrNotFound {
+		return err
+	}
+	toScore := BytesToUint64(toScoreB)
+	if scoreMax-toScore < amount {
+		return errors.New("overflow number")
+	}
+
+	batch := new(leveldb.Batch)
+	if _, err = db.stageZset(batch, nameB, from, Uint64ToBytes(fromScore-amount)); err != nil {
+		return err
+	}
+	if _, err = db.stageZset(batch, nameB, to, Uint64ToBytes(toScore+amount)); err != nil {
+		return err
+	}
+	return db.write(batch)
+}
+
+// ZpopMinN removes and returns up to n members of a zset with the lowest scores,
+// as key/score pairs in ascending order, in a single batch.
+func (db *DB) ZpopMinN(name string, n int) *Reply {
+	return db.zpopN(name, n, false)
+}
+
+// ZpopMaxN removes and returns up to n members of a zset with the highest scores,
+// as key/score pairs in descending order, in a single batch.
+func (db *DB) ZpopMaxN(name string, n int) *Reply {
+	return db.zpopN(name, n, true)
+}
+
+func (db *DB) zpopN(name string, n int, reverse bool) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	nameB := StringToBytesNoCopy(name)
+	keyPrefix := Bconcat(zetKeyPrefix, nameB, splitChar)
+	defer db.lockKey(keyPrefix)()
+
+	batch := new(leveldb.Batch)
+	iter := db.newIterator(util.BytesPrefix(keyPrefix), nil)
+	next, ok := iter.Next, iter.First()
+	if reverse {
+		next, ok = iter.Prev, iter.Last()
+	}
+	size := 0
+	for ; ok && len(r.Data) < 2*n; ok = next() {
+		scoreKey := iter.Key()[len(keyPrefix):]
+		score := append([]byte{}, scoreKey[:scoreByteLen]...)
+		key := append([]byte{}, scoreKey[scoreByteLen+1:]...)
+		r.Data = append(r.Data, key, score)
+		// only the members returned are removed
+		if db.replyFull(r, &size) {
+			break
+		}
+		if err := db.stageZdel(batch, nameB, key, score); err != nil {
+			iter.Release()
+			r.State = err.Error()
+			r.Data = []BS{}
+			return r
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		r.State = err.Error()
+		r.Data = []BS{}
+		return r
+	}
+	if len(r.Data) == 0 {
+		return r
+	}
+	if err := db.write(batch); err != nil {
+		r.State = err.Error()
+		r.Data = []BS{}
+		return r
+	}
+	if r.State != replyTooLarge {
+		r.State = replyOK
+	}
+	return r
+}
+
 // Zget get the score related to the specified key of a zset.
 func (db *DB) Zget(name string, key []byte) uint64 {
 	val, err := db.Get(Bconcat(zetScorePrefix, StringToBytesNoCopy(name), splitChar, key), nil)
@@ -391,6 +2002,15 @@ func (db *DB) Zget(name string, key []byte) uint64 {
 	return BytesToUint64(val)
 }
 
+// ZgetDefault get the score related to the specified key of a zset, or def if the key does not exist.
+func (db *DB) ZgetDefault(name string, key []byte, def uint64) uint64 {
+	val, err := db.Get(Bconcat(zetScorePrefix, StringToBytesNoCopy(name), splitChar, key), nil)
+	if err != nil {
+		return def
+	}
+	return BytesToUint64(val)
+}
+
 func (db *DB) ZhasKey(name string, key []byte) bool {
 	has, err := db.Has(Bconcat(zetScorePrefix, StringToBytesNoCopy(name), splitChar, key), nil)
 	if err != nil {
@@ -403,50 +2023,174 @@ func (db *DB) ZhasKey(name string, key []byte) bool {
 func (db *DB) Zdel(name string, key []byte) error {
 	nameB := StringToBytesNoCopy(name)
 	keyScore := Bconcat(zetScorePrefix, nameB, splitChar, key) // key / score
+	if db.zsetChampion {
+		defer db.lockChampions(nameB)()
+	}
 
 	oldScore, err := db.Get(keyScore, nil)
 	if err != nil {
 		return err
 	}
-
-	batch := new(leveldb.Batch)
-	batch.Delete(keyScore)
-	batch.Delete(Bconcat(zetKeyPrefix, nameB, splitChar, oldScore, splitChar, key))
-	return db.Write(batch, nil)
+
+	batch := new(leveldb.Batch)
+	if err = db.stageZdel(batch, nameB, key, oldScore); err != nil {
+		return err
+	}
+	if db.zsetChampion {
+		if err = db.stageChampion(batch, nameB, key, nil); err != nil {
+			return err
+		}
+	}
+	return db.write(batch)
+}
+
+// ZdelBucket delete all keys in a zset.
+func (db *DB) ZdelBucket(name string) error {
+	nameB := StringToBytesNoCopy(name)
+	defer db.lockKey(zsignedKey(nameB))()
+	if db.zsetChampion {
+		defer db.lockChampions(nameB)()
+	}
+	batch := new(leveldb.Batch)
+	batch.Delete(zsignedKey(nameB))
+
+	for _, prefix := range [][]byte{
+		Bconcat(zetScorePrefix, nameB, splitChar),
+		Bconcat(zetKeyPrefix, nameB, splitChar),
+		zinsSeqPrefix(nameB),
+		zinsKeyPrefix(nameB),
+	} {
+		iter := db.newIterator(util.BytesPrefix(prefix), nil)
+		for iter.Next() {
+			batch.Delete(iter.Key())
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+	if db.zsetChampion {
+		batch.Delete(zchampKey(nameB))
+	}
+
+	return db.write(batch)
+}
+
+// Zrename renames a zset in a single batch, moving both indexes, the insertion order and
+// the signed migration progress.
+// It fails if newName already has members.
+func (db *DB) Zrename(oldName, newName string) error {
+	if oldName == newName {
+		return nil
+	}
+	oldB, newB := StringToBytesNoCopy(oldName), StringToBytesNoCopy(newName)
+	prefixes := func(nameB []byte) [][]byte {
+		return [][]byte{
+			Bconcat(zetScorePrefix, nameB, splitChar),
+			Bconcat(zetKeyPrefix, nameB, splitChar),
+			zinsSeqPrefix(nameB),
+			zinsKeyPrefix(nameB),
+		}
+	}
+	oldPrefixes, newPrefixes := prefixes(oldB), prefixes(newB)
+	oldMarker, newMarker := zsignedKey(oldB), zsignedKey(newB)
+	defer db.lockKeys(oldPrefixes[1], newPrefixes[1], oldMarker, newMarker)()
+
+	iter := db.newIterator(util.BytesPrefix(newPrefixes[0]), nil)
+	exists := iter.First()
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("zset " + newName + " already exists")
+	}
+
+	// the migration progress follows the members
+	batch := new(leveldb.Batch)
+	batch.Delete(newMarker)
+	marker, err := db.getRaw(oldMarker)
+	if err != nil {
+		return err
+	}
+	if marker != nil {
+		batch.Put(newMarker, marker)
+		batch.Delete(oldMarker)
+	}
+	for i, oldPrefix := range oldPrefixes {
+		iter = db.newIterator(util.BytesPrefix(oldPrefix), nil)
+		for iter.Next() {
+			batch.Put(Bconcat(newPrefixes[i], iter.Key()[len(oldPrefix):]), iter.Value())
+			batch.Delete(iter.Key())
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+	return db.write(batch)
 }
 
-// ZdelBucket delete all keys in a zset.
-func (db *DB) ZdelBucket(name string) error {
-	nameB := StringToBytesNoCopy(name)
-	batch := new(leveldb.Batch)
+// Zsum returns the total score of all members in a zset, or an error if it overflows uint64.
+func (db *DB) Zsum(name string) (uint64, error) {
+	var sum uint64
+	iter := db.newIterator(util.BytesPrefix(Bconcat(zetScorePrefix, StringToBytesNoCopy(name), splitChar)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		score := BytesToUint64(iter.Value())
+		if scoreMax-sum < score {
+			return 0, errors.New("overflow number")
+		}
+		sum += score
+	}
+	return sum, iter.Error()
+}
 
-	iter := db.NewIterator(util.BytesPrefix(Bconcat(zetScorePrefix, nameB, splitChar)), nil)
+// Zhistogram counts the members of a zset per score bucket of width bucketSize,
+// keyed by the lower bound of the bucket.
+func (db *DB) Zhistogram(name string, bucketSize uint64) (map[uint64]int64, error) {
+	if bucketSize == 0 {
+		return nil, errors.New("bucket size must be positive")
+	}
+	hist := make(map[uint64]int64)
+	iter := db.newIterator(util.BytesPrefix(Bconcat(zetScorePrefix, StringToBytesNoCopy(name), splitChar)), nil)
+	defer iter.Release()
 	for iter.Next() {
-		batch.Delete(iter.Key())
+		score := BytesToUint64(iter.Value())
+		hist[score-score%bucketSize]++
 	}
-	iter.Release()
-	err := iter.Error()
-	if err != nil {
-		return err
+	if err := iter.Error(); err != nil {
+		return nil, err
 	}
+	return hist, nil
+}
 
-	iter = db.NewIterator(util.BytesPrefix(Bconcat(zetKeyPrefix, nameB, splitChar)), nil)
+// Zavg returns the mean score of all members in a zset, 0 for an empty zset.
+// The total is accumulated without overflow.
+func (db *DB) Zavg(name string) (float64, error) {
+	sum := new(big.Int)
+	score := new(big.Int)
+	var count int64
+	iter := db.newIterator(util.BytesPrefix(Bconcat(zetScorePrefix, StringToBytesNoCopy(name), splitChar)), nil)
+	defer iter.Release()
 	for iter.Next() {
-		batch.Delete(iter.Key())
+		sum.Add(sum, score.SetUint64(BytesToUint64(iter.Value())))
+		count++
 	}
-	iter.Release()
-	err = iter.Error()
-	if err != nil {
-		return err
+	if err := iter.Error(); err != nil {
+		return 0, err
 	}
-
-	return db.Write(batch, nil)
+	if count == 0 {
+		return 0, nil
+	}
+	avg, _ := new(big.Float).Quo(new(big.Float).SetInt(sum), big.NewFloat(float64(count))).Float64()
+	return avg, nil
 }
 
 // Zmset et multiple key-score pairs of a zset in one method call.
 func (db *DB) Zmset(name string, kvs [][]byte) error {
 	if len(kvs) == 0 || len(kvs)%2 != 0 {
-		return errors.New("kvs len must is an even number")
+		return ErrOddKVCount
 	}
 	nameB := StringToBytesNoCopy(name)
 
@@ -460,14 +2204,51 @@ func (db *DB) Zmset(name string, kvs [][]byte) error {
 		keyScore := Bconcat(keyPrefix1, key)                      // key / score
 		newScoreKey := Bconcat(keyPrefix2, score, splitChar, key) // name+score+key / nil
 
-		oldScore, _ := db.Get(keyScore, nil)
+		oldScore, err := db.getRaw(keyScore)
+		if err != nil {
+			return err
+		}
 		if !bytes.Equal(oldScore, score) {
 			batch.Put(keyScore, score)
 			batch.Put(newScoreKey, nil)
 			batch.Delete(Bconcat(keyPrefix2, oldScore, splitChar, key))
+			if oldScore == nil && db.zsetInsertion {
+				db.stageZinsert(batch, nameB, key)
+			}
+		}
+	}
+	return db.write(batch)
+}
+
+// ZaddValidated set the scores of multiple keys of a zset in one batch, skipping the members
+// whose score fails valid. If a key repeats in members, its last occurrence wins.
+func (db *DB) ZaddValidated(name string, members []ZEntry, valid func(score uint64) bool) (accepted, rejected int, err error) {
+	nameB := StringToBytesNoCopy(name)
+	last := make(map[string]int, len(members))
+	for i, m := range members {
+		last[string(m.Key)] = i
+	}
+
+	batch := new(leveldb.Batch)
+	for i, m := range members {
+		if last[string(m.Key)] != i {
+			continue
+		}
+		if !valid(m.Score) {
+			rejected++
+			continue
+		}
+		if _, err = db.stageZset(batch, nameB, m.Key, Uint64ToBytes(m.Score)); err != nil {
+			return 0, 0, err
+		}
+		accepted++
+	}
+	if batch.Len() > 0 {
+		if err = db.write(batch); err != nil {
+			return 0, 0, err
 		}
 	}
-	return db.Write(batch, nil)
+	return accepted, rejected, nil
 }
 
 // Zmget get the values related to the specified multiple keys of a zset.
@@ -491,6 +2272,208 @@ func (db *DB) Zmget(name string, keys [][]byte) *Reply {
 	return r
 }
 
+// ZmgetScores get the scores of the specified multiple keys of a zset, aligned with keys.
+// found[i] is false and scores[i] is 0 for a key that does not exist.
+func (db *DB) ZmgetScores(name string, keys [][]byte) (scores []uint64, found []bool, err error) {
+	scores = make([]uint64, len(keys))
+	found = make([]bool, len(keys))
+	keyPrefix := Bconcat(zetScorePrefix, StringToBytesNoCopy(name), splitChar)
+	for i, key := range keys {
+		val, err := db.Get(Bconcat(keyPrefix, key), nil)
+		if err == errors.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		scores[i] = BytesToUint64(val)
+		found[i] = true
+	}
+	return scores, found, nil
+}
+
+// Zscores get the scores of the specified multiple keys of a zset, missing keys are omitted.
+func (db *DB) Zscores(name string, keys [][]byte) (map[string]uint64, error) {
+	scores := make(map[string]uint64, len(keys))
+	keyPrefix := Bconcat(zetScorePrefix, StringToBytesNoCopy(name), splitChar)
+	for _, key := range keys {
+		val, err := db.Get(Bconcat(keyPrefix, key), nil)
+		if err != nil {
+			if err == errors.ErrNotFound {
+				continue
+			}
+			return nil, err
+		}
+		scores[string(key)] = BytesToUint64(val)
+	}
+	return scores, nil
+}
+
+// ZmembersByScore list key-score pairs of a zset whose score equals one of scores, grouped in the order of scores.
+func (db *DB) ZmembersByScore(name string, scores []uint64) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	keyPrefix := Bconcat(zetKeyPrefix, StringToBytesNoCopy(name), splitChar)
+	size := 0
+	for _, score := range scores {
+		scoreB := Uint64ToBytes(score)
+		scorePrefix := Bconcat(keyPrefix, scoreB, splitChar)
+		iter := db.newIterator(util.BytesPrefix(scorePrefix), nil)
+		for iter.Next() {
+			r.Data = append(r.Data, append([]byte{}, iter.Key()[len(scorePrefix):]...), scoreB)
+			if db.replyFull(r, &size) {
+				iter.Release()
+				return r
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			r.State = err.Error()
+			r.Data = []BS{}
+			return r
+		}
+	}
+	if len(r.Data) > 0 {
+		r.State = replyOK
+	}
+	return r
+}
+
+// Zrangebylex returns the members of a zset holding scoreConst whose keys fall lexically
+// in [min, max], like Redis ZRANGEBYLEX. An empty min or max leaves that end unbounded.
+func (db *DB) Zrangebylex(name string, scoreConst uint64, min, max []byte, limit int) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	scoreB := Uint64ToBytes(scoreConst)
+	scorePrefix := Bconcat(zetKeyPrefix, StringToBytesNoCopy(name), splitChar, scoreB, splitChar)
+	rg := util.BytesPrefix(scorePrefix)
+	if len(min) > 0 {
+		rg.Start = Bconcat(scorePrefix, min)
+	}
+	if len(max) > 0 {
+		rg.Limit = Bconcat(scorePrefix, max, []byte{0})
+	}
+
+	iter := db.newIterator(rg, nil)
+	n, size := 0, 0
+	for iter.Next() {
+		r.Data = append(r.Data, append([]byte{}, iter.Key()[len(scorePrefix):]...), scoreB)
+		if db.replyFull(r, &size) {
+			iter.Release()
+			return r
+		}
+		n++
+		if n == limit {
+			break
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		r.State = err.Error()
+		r.Data = []BS{}
+		return r
+	}
+	if n > 0 {
+		r.State = replyOK
+	}
+	return r
+}
+
+// ZscanPrefix list key-score pairs of a zset whose keys start with keyPrefix and whose scores
+// fall in [min, max], ordered by score. It walks either the score index filtering on keyPrefix
+// or the keys under keyPrefix filtering on score, whichever SizeOf estimates to be smaller.
+func (db *DB) ZscanPrefix(name string, keyPrefix []byte, min, max uint64, limit int) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	if min > max {
+		return r
+	}
+	nameB := StringToBytesNoCopy(name)
+	indexPrefix := Bconcat(zetKeyPrefix, nameB, splitChar)
+	byScore := util.Range{
+		Start: Bconcat(indexPrefix, Uint64ToBytes(min)),
+		Limit: util.BytesPrefix(Bconcat(indexPrefix, Uint64ToBytes(max))).Limit,
+	}
+	memberPrefix := Bconcat(zetScorePrefix, nameB, splitChar)
+	byMember := util.BytesPrefix(Bconcat(memberPrefix, keyPrefix))
+	sizes, err := db.SizeOf([]util.Range{byScore, *byMember})
+	if err != nil {
+		r.State = err.Error()
+		return r
+	}
+
+	var entries []ZEntry
+	n, size := 0, 0
+	if sizes[1] < sizes[0] {
+		iter := db.newIterator(byMember, nil)
+		for iter.Next() {
+			score := BytesToUint64(iter.Value())
+			if score >= min && score <= max {
+				entries = append(entries, ZEntry{Key: append([]byte{}, iter.Key()[len(memberPrefix):]...), Score: score})
+			}
+		}
+		iter.Release()
+		err = iter.Error()
+		slices.SortFunc(entries, func(a, b ZEntry) int {
+			if a.Score != b.Score {
+				if a.Score < b.Score {
+					return -1
+				}
+				return 1
+			}
+			return bytes.Compare(a.Key, b.Key)
+		})
+		for _, e := range entries {
+			r.Data = append(r.Data, e.Key, Uint64ToBytes(e.Score))
+			if db.replyFull(r, &size) {
+				return r
+			}
+			n++
+			if n == limit {
+				break
+			}
+		}
+	} else {
+		keyBeginIndex := len(indexPrefix) + scoreByteLen + 1
+		iter := db.newIterator(&byScore, nil)
+		for iter.Next() {
+			key := iter.Key()[keyBeginIndex:]
+			if !bytes.HasPrefix(key, keyPrefix) {
+				continue
+			}
+			r.Data = append(r.Data,
+				append([]byte{}, key...),
+				append([]byte{}, iter.Key()[len(indexPrefix):keyBeginIndex-1]...),
+			)
+			if db.replyFull(r, &size) {
+				iter.Release()
+				return r
+			}
+			n++
+			if n == limit {
+				break
+			}
+		}
+		iter.Release()
+		err = iter.Error()
+	}
+	if err != nil {
+		r.State = err.Error()
+		r.Data = []BS{}
+		return r
+	}
+	if n > 0 {
+		r.State = replyOK
+	}
+	return r
+}
+
 // Zmdel delete specified multiple keys of a zset.
 func (db *DB) Zmdel(name string, keys [][]byte) error {
 	nameB := StringToBytesNoCopy(name)
@@ -505,19 +2488,83 @@ func (db *DB) Zmdel(name string, keys [][]byte) error {
 		}
 		batch.Delete(keyScore)
 		batch.Delete(Bconcat(keyPrefix2, oldScore, splitChar, key))
+		if db.zsetInsertion {
+			if err = db.stageZuninsert(batch, nameB, key); err != nil {
+				return err
+			}
+		}
+	}
+	return db.write(batch)
+}
+
+// ZjoinFunc walks two zsets in member order and calls fn for every distinct member,
+// inA and inB report in which zset the member exists. The walk stops when fn returns false.
+func (db *DB) ZjoinFunc(nameA, nameB string, fn func(key []byte, scoreA, scoreB uint64, inA, inB bool) bool) error {
+	prefixA := Bconcat(zetScorePrefix, StringToBytesNoCopy(nameA), splitChar)
+	prefixB := Bconcat(zetScorePrefix, StringToBytesNoCopy(nameB), splitChar)
+	iters := db.newIterators([]*util.Range{util.BytesPrefix(prefixA), util.BytesPrefix(prefixB)}, nil)
+	iterA, iterB := iters[0], iters[1]
+	defer iterA.Release()
+	defer iterB.Release()
+
+	okA, okB := iterA.First(), iterB.First()
+	for okA || okB {
+		var keyA, keyB []byte
+		if okA {
+			keyA = iterA.Key()[len(prefixA):]
+		}
+		if okB {
+			keyB = iterB.Key()[len(prefixB):]
+		}
+
+		c := 0
+		switch {
+		case !okA:
+			c = 1
+		case !okB:
+			c = -1
+		default:
+			c = bytes.Compare(keyA, keyB)
+		}
+
+		var cont bool
+		switch {
+		case c < 0:
+			cont = fn(append([]byte{}, keyA...), BytesToUint64(iterA.Value()), 0, true, false)
+			okA = iterA.Next()
+		case c > 0:
+			cont = fn(append([]byte{}, keyB...), 0, BytesToUint64(iterB.Value()), false, true)
+			okB = iterB.Next()
+		default:
+			cont = fn(append([]byte{}, keyA...), BytesToUint64(iterA.Value()), BytesToUint64(iterB.Value()), true, true)
+			okA, okB = iterA.Next(), iterB.Next()
+		}
+		if !cont {
+			break
+		}
+	}
+
+	if err := iterA.Error(); err != nil {
+		return err
 	}
-	return db.Write(batch, nil)
+	return iterB.Error()
 }
 
 // Zscan list key-score pairs in a zset, where key-score in range (key_start+score_start, score_end].
+// scoreStart must be produced with ScoreToBytes, an empty scoreStart starts from the lowest score.
 func (db *DB) Zscan(name string, keyStart, scoreStart []byte, limit int) *Reply {
+	return db.zscan(name, keyStart, scoreStart, limit, scoreByteLen)
+}
+
+// zscan implements Zscan for zsets whose scores are scoreLen bytes long.
+func (db *DB) zscan(name string, keyStart, scoreStart []byte, limit int, scoreLen int) *Reply {
 	r := &Reply{
 		State: replyError,
 		Data:  []BS{},
 	}
 
 	if len(scoreStart) == 0 {
-		scoreStart = Uint64ToBytes(scoreMin)
+		scoreStart = make([]byte, scoreLen)
 	}
 
 	keyPrefix := Bconcat(zetKeyPrefix, StringToBytesNoCopy(name), splitChar)
@@ -525,21 +2572,25 @@ func (db *DB) Zscan(name string, keyStart, scoreStart []byte, limit int) *Reply
 	// zetKeyPrefix+name+splitChar+score+splitChar+key
 	// split by splitChar: [zetKeyPrefix+name, score, key, ...]
 	scoreBeginIndex := len(keyPrefix)
-	scoreEndIndex := scoreBeginIndex + scoreByteLen
-	keyBeginIndex := scoreBeginIndex + scoreByteLen + 1
-	n := 0
+	scoreEndIndex := scoreBeginIndex + scoreLen
+	keyBeginIndex := scoreBeginIndex + scoreLen + 1
+	n, size := 0, 0
 	sliceRange := util.BytesPrefix(keyPrefix)
 	if len(keyStart) == 0 {
 		realKey = util.BytesPrefix(Bconcat(keyPrefix, scoreStart, splitChar)).Limit
 	}
 	sliceRange.Start = realKey
-	iter := db.NewIterator(sliceRange, nil)
+	iter := db.newIterator(sliceRange, nil)
 	for ok := iter.First(); ok; ok = iter.Next() {
 		if bytes.Compare(realKey, iter.Key()) == -1 {
 			r.Data = append(r.Data,
 				append([]byte{}, iter.Key()[keyBeginIndex:]...),                // key
 				append([]byte{}, iter.Key()[scoreBeginIndex:scoreEndIndex]...), // score
 			)
+			if db.replyFull(r, &size) {
+				iter.Release()
+				return r
+			}
 			n++
 			if n == limit {
 				break
@@ -561,6 +2612,7 @@ func (db *DB) Zscan(name string, keyStart, scoreStart []byte, limit int) *Reply
 }
 
 // Zrscan list key-score pairs of a zset, in reverse order.
+// scoreStart must be produced with ScoreToBytes, an empty scoreStart starts from the highest score.
 func (db *DB) Zrscan(name string, keyStart, scoreStart []byte, limit int) *Reply {
 	r := &Reply{
 		State: replyError,
@@ -576,19 +2628,23 @@ func (db *DB) Zrscan(name string, keyStart, scoreStart []byte, limit int) *Reply
 	scoreBeginIndex := len(keyPrefix)
 	scoreEndIndex := scoreBeginIndex + scoreByteLen
 	keyBeginIndex := scoreBeginIndex + scoreByteLen + 1
-	n := 0
+	n, size := 0, 0
 	sliceRange := util.BytesPrefix(keyPrefix)
 	if len(keyStart) == 0 {
 		realKey = util.BytesPrefix(Bconcat(keyPrefix, scoreStart, splitChar)).Start
 	}
 	sliceRange.Limit = realKey
-	iter := db.NewIterator(sliceRange, nil)
+	iter := db.newIterator(sliceRange, nil)
 	for ok := iter.Last(); ok; ok = iter.Prev() {
 		if bytes.Compare(realKey, iter.Key()) == 1 {
 			r.Data = append(r.Data,
 				append([]byte{}, iter.Key()[keyBeginIndex:]...),                // key
 				append([]byte{}, iter.Key()[scoreBeginIndex:scoreEndIndex]...), // score
 			)
+			if db.replyFull(r, &size) {
+				iter.Release()
+				return r
+			}
 			n++
 			if n == limit {
 				break
@@ -609,6 +2665,46 @@ func (db *DB) Zrscan(name string, keyStart, scoreStart []byte, limit int) *Reply
 	return r
 }
 
+// ZtopN list the key-score pairs of the n members of a zset with the highest scores, highest
+// first like Zrscan, or reversed to read from low to high when ascendingOutput.
+func (db *DB) ZtopN(name string, n int, ascendingOutput bool) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	keyPrefix := Bconcat(zetKeyPrefix, StringToBytesNoCopy(name), splitChar)
+	keyBeginIndex := len(keyPrefix) + scoreByteLen + 1
+	size := 0
+	iter := db.newIterator(util.BytesPrefix(keyPrefix), nil)
+	for ok := iter.Last(); ok; ok = iter.Prev() {
+		r.Data = append(r.Data,
+			append([]byte{}, iter.Key()[keyBeginIndex:]...),                 // key
+			append([]byte{}, iter.Key()[len(keyPrefix):keyBeginIndex-1]...), // score
+		)
+		if db.replyFull(r, &size) {
+			break
+		}
+		if len(r.Data)/2 == n {
+			break
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		r.State = err.Error()
+		r.Data = []BS{}
+		return r
+	}
+	if ascendingOutput {
+		for i, j := 0, len(r.Data)-2; i < j; i, j = i+2, j-2 {
+			r.Data[i], r.Data[i+1], r.Data[j], r.Data[j+1] = r.Data[j], r.Data[j+1], r.Data[i], r.Data[i+1]
+		}
+	}
+	if r.State != replyTooLarge && len(r.Data) > 0 {
+		r.State = replyOK
+	}
+	return r
+}
+
 func (r *Reply) OK() bool {
 	return r.State == replyOK
 }
@@ -690,6 +2786,126 @@ func (r *Reply) KvEach(fn func(key, value BS)) int {
 	return r.KvLen()
 }
 
+// Columns splits the key-value pairs of the reply into aligned keys and values sharing the
+// bytes of Data. A trailing unpaired item is left out, like KvEach does.
+func (r *Reply) Columns() (keys []BS, values []BS) {
+	n := len(r.Data) / 2
+	keys = make([]BS, 0, n)
+	values = make([]BS, 0, n)
+	for i := 0; i < 2*n; i += 2 {
+		keys = append(keys, r.Data[i])
+		values = append(values, r.Data[i+1])
+	}
+	return keys, values
+}
+
+// JoinValues concatenates the values of the key-value pairs of the reply in order, e.g. to
+// reassemble a blob stored in chunks read back with Hmget. A trailing unpaired item is left
+// out, use JoinAll for replies holding values only.
+func (r *Reply) JoinValues() []byte {
+	values := make([][]byte, 0, len(r.Data)/2)
+	for i := 1; i < len(r.Data); i += 2 {
+		values = append(values, r.Data[i])
+	}
+	return Bconcat(values...)
+}
+
+// JoinAll concatenates every item of the reply in order, for replies holding values only
+// such as Hget or Hchildren.
+func (r *Reply) JoinAll() []byte {
+	items := make([][]byte, len(r.Data))
+	for i, item := range r.Data {
+		items[i] = item
+	}
+	return Bconcat(items...)
+}
+
+// Debug returns a readable representation of the reply for logging,
+// like `OK [key1=val1, key2=val2]`, non-printable bytes are hex-escaped.
+func (r *Reply) Debug() string {
+	var sb strings.Builder
+	if r.OK() {
+		sb.WriteString("OK")
+	} else {
+		sb.WriteString(r.State)
+	}
+	sb.WriteString(" [")
+	pairs := len(r.Data)%2 == 0
+	for i, b := range r.Data {
+		if i > 0 {
+			if pairs && i%2 == 1 {
+				sb.WriteByte('=')
+			} else {
+				sb.WriteString(", ")
+			}
+		}
+		writeEscaped(&sb, b)
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+// MarshalJSON renders the reply as `{"ok":true,"data":...}`, data is an object for key/value
+// replies and an array otherwise. Bytes are emitted as strings when valid UTF-8 and base64
+// encoded otherwise. Failed replies carry `"notFound":true` or the `"error"` state instead.
+func (r *Reply) MarshalJSON() ([]byte, error) {
+	if r.NotFound() {
+		return []byte(`{"ok":false,"notFound":true}`), nil
+	}
+	if !r.OK() {
+		errB, err := json.Marshal(r.State)
+		if err != nil {
+			return nil, err
+		}
+		return Bconcat([]byte(`{"ok":false,"error":`), errB, []byte("}")), nil
+	}
+
+	buf := bytes.NewBufferString(`{"ok":true,"data":`)
+	pairs := len(r.Data)%2 == 0
+	if pairs {
+		buf.WriteByte('{')
+	} else {
+		buf.WriteByte('[')
+	}
+	for i, b := range r.Data {
+		if i > 0 {
+			if pairs && i%2 == 1 {
+				buf.WriteByte(':')
+			} else {
+				buf.WriteByte(',')
+			}
+		}
+		s := base64.StdEncoding.EncodeToString(b)
+		if utf8.Valid(b) {
+			s = string(b)
+		}
+		sB, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(sB)
+	}
+	if pairs {
+		buf.WriteString("}}")
+	} else {
+		buf.WriteString("]}")
+	}
+	return buf.Bytes(), nil
+}
+
+func writeEscaped(sb *strings.Builder, b []byte) {
+	const hex = "0123456789abcdef"
+	for _, c := range b {
+		if c >= 0x20 && c < 0x7f && c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteString(`\x`)
+		sb.WriteByte(hex[c>>4])
+		sb.WriteByte(hex[c&0x0f])
+	}
+}
+
 func (b BS) Bytes() []byte {
 	return b
 }
@@ -721,6 +2937,49 @@ func (b BS) Uint64() uint64 {
 	return binary.BigEndian.Uint64(b)
 }
 
+// incrBy returns num incremented by step, or an error if the result overflows uint64.
+func incrBy(num uint64, step int64) (uint64, error) {
+	if step > 0 {
+		if (scoreMax - uint64(step)) < num {
+			return 0, errors.New("overflow number")
+		}
+		return num + uint64(step), nil
+	}
+	if uint64(-step) > num {
+		return 0, errors.New("overflow number")
+	}
+	return num - uint64(-step), nil
+}
+
+// HashKey returns the leveldb key storing the key of a hashmap.
+func HashKey(name string, key []byte) []byte {
+	return Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
+}
+
+// ZsetScoreKey returns the leveldb key storing the score of the key of a zset.
+func ZsetScoreKey(name string, key []byte) []byte {
+	return Bconcat(zetScorePrefix, StringToBytesNoCopy(name), splitChar, key)
+}
+
+// ZsetIndexKey returns the leveldb key indexing the key of a zset by score, zset
+// scans iterate these keys in order.
+func ZsetIndexKey(name string, score uint64, key []byte) []byte {
+	return Bconcat(zetKeyPrefix, StringToBytesNoCopy(name), splitChar, Uint64ToBytes(score), splitChar, key)
+}
+
+// NextPrefix returns the smallest key greater than every key starting with p, the Limit
+// util.BytesPrefix would use, or nil if there is none because p is empty or all 0xFF.
+func NextPrefix(p []byte) []byte {
+	for i := len(p) - 1; i >= 0; i-- {
+		if p[i] < 0xff {
+			limit := append([]byte{}, p[:i+1]...)
+			limit[i]++
+			return limit
+		}
+	}
+	return nil
+}
+
 // Bconcat concat a list of byte
 func Bconcat(slices ...[]byte) []byte {
 	var totalLen int
@@ -761,6 +3020,17 @@ func DigitStringToUint64(v string) uint64 {
 	return i
 }
 
+// ScoreToBytes returns the order-preserving encoding of a zset score,
+// use it to build the scoreStart argument of Zscan and Zrscan.
+func ScoreToBytes(score uint64) []byte {
+	return Uint64ToBytes(score)
+}
+
+// BytesToScore decodes a zset score encoded by ScoreToBytes, e.g. from a Zscan reply.
+func BytesToScore(b []byte) uint64 {
+	return BytesToUint64(b)
+}
+
 // Uint64ToBytes returns an 8-byte big endian representation of v
 // v uint64(123456) -> 8-byte big endian.
 func Uint64ToBytes(v uint64) []byte {
@@ -777,19 +3047,3 @@ func BytesToUint64(v []byte) uint64 {
 	}
 	return binary.BigEndian.Uint64(v[:8])
 }
-
-// BytesToStringNoCopy converts byte slice to a string without memory allocation.
-// []byte("abc") -> "abc" s
-func BytesToStringNoCopy(b []byte) string {
-	/* #nosec G103 */
-	return *(*string)(unsafe.Pointer(&b))
-}
-
-// StringToBytesNoCopy converts string to a byte slice without memory allocation.
-// "abc" -> []byte("abc")
-func StringToBytesNoCopy(s string) []byte {
-	ptr := unsafe.StringData(s)
-	b := unsafe.Slice(ptr, len(s))
-	runtime.KeepAlive(&s)
-	return b
-}
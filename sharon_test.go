@@ -1,12 +1,25 @@
 package sharon_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/ehebe/sharon"
+	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 func setupDB(t *testing.T) *sharon.DB {
@@ -43,6 +56,56 @@ func TestHsetHget(t *testing.T) {
 	}
 }
 
+func TestHsetReport(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "upserts"
+	key := []byte("k")
+	for i, want := range []bool{true, false} {
+		created, err := db.HsetReport(name, key, []byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatalf("HsetReport failed: %v", err)
+		}
+		if created != want {
+			t.Errorf("set #%d: expected created=%v, got %v", i, want, created)
+		}
+	}
+	if got := db.Hget(name, key).String(); got != "1" {
+		t.Errorf("expected overwritten value 1, got %q", got)
+	}
+}
+
+func TestHgetall(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "small"
+	_ = db.Hmset(name, []byte("a"), []byte("1"), []byte("b"), []byte("2"), []byte("c"), []byte{})
+	all, err := db.Hgetall(name)
+	if err != nil {
+		t.Fatalf("Hgetall failed: %v", err)
+	}
+	want := map[string]string{"a": "1", "b": "2", "c": ""}
+	if len(all) != len(want) {
+		t.Errorf("expected %d keys, got %d", len(want), len(all))
+	}
+	for k, v := range want {
+		if got, ok := all[k]; !ok || string(got) != v {
+			t.Errorf("%s: expected %q, got %q", k, v, got)
+		}
+	}
+
+	db.SetHgetallMax(3)
+	if _, err = db.Hgetall(name); err != nil {
+		t.Errorf("expected a bucket at the cap to load, got %v", err)
+	}
+	_ = db.Hset(name, []byte("d"), []byte("4"))
+	if all, err = db.Hgetall(name); !errors.Is(err, sharon.ErrBucketTooLarge) || all != nil {
+		t.Errorf("expected ErrBucketTooLarge, got %v", err)
+	}
+}
+
 func TestHgetNotFound(t *testing.T) {
 	db := setupDB(t)
 	defer db.Close()
@@ -53,6 +116,41 @@ func TestHgetNotFound(t *testing.T) {
 	}
 }
 
+func TestHmgetDuplicateKeys(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "dups"
+	_ = db.Hmset(name, []byte("a"), []byte("1"), []byte("b"), []byte{})
+
+	reads := 0
+	db.SetReadFunc(func(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+		reads++
+		return db.Get(key, ro)
+	})
+	defer db.SetReadFunc(nil)
+
+	keys := [][]byte{[]byte("missing"), []byte("b")}
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte("a"), []byte("missing"))
+	}
+	rs := db.Hmget(name, keys)
+	if reads != 3 {
+		t.Errorf("expected 3 reads for 3 distinct keys, got %d", reads)
+	}
+	if rs.KvLen() != 101 {
+		t.Fatalf("expected 101 pairs, got %d", rs.KvLen())
+	}
+	if rs.Data[0].String() != "b" || len(rs.Data[1]) != 0 {
+		t.Errorf("expected b with empty value first, got %s=%q", rs.Data[0], rs.Data[1])
+	}
+	for i := 2; i < len(rs.Data); i += 2 {
+		if rs.Data[i].String() != "a" || rs.Data[i+1].String() != "1" {
+			t.Fatalf("pair %d: expected a=1, got %s=%s", i/2, rs.Data[i], rs.Data[i+1])
+		}
+	}
+}
+
 func TestHIncr(t *testing.T) {
 	db := setupDB(t)
 	defer db.Close()
@@ -77,6 +175,78 @@ func TestHIncr(t *testing.T) {
 	}
 }
 
+func TestIncrZeroStep(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	_ = db.Zset("zero", []byte("k"), 7)
+	_, _ = db.Hincr("zero", []byte("k"), 3)
+
+	writes := 0
+	db.SetWriteFunc(func(batch *leveldb.Batch) error {
+		writes++
+		return db.Write(batch, nil)
+	})
+	if score, err := db.Zincr("zero", []byte("k"), 0); err != nil || score != 7 {
+		t.Errorf("expected Zincr to return 7, got %d %v", score, err)
+	}
+	if num, err := db.Hincr("zero", []byte("k"), 0); err != nil || num != 3 {
+		t.Errorf("expected Hincr to return 3, got %d %v", num, err)
+	}
+	if writes != 0 {
+		t.Errorf("expected no writes for a zero step, got %d", writes)
+	}
+}
+
+func TestHincrEx(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "counter"
+	key := []byte("cnt")
+
+	if _, err := db.Hincr(name, key, 40); err != nil {
+		t.Fatalf("Hincr failed: %v", err)
+	}
+
+	oldNum, newNum, err := db.HincrEx(name, key, 2)
+	if err != nil {
+		t.Fatalf("HincrEx failed: %v", err)
+	}
+	if oldNum != 40 || newNum != 42 {
+		t.Errorf("expected 40 -> 42, got %d -> %d", oldNum, newNum)
+	}
+	if newNum-oldNum != 2 {
+		t.Errorf("expected difference 2, got %d", newNum-oldNum)
+	}
+
+	if _, _, err = db.HincrEx(name, key, -100); err == nil {
+		t.Errorf("expected overflow error")
+	}
+}
+
+func TestHincrFrom(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "counter"
+	key := []byte("seeded")
+
+	val, err := db.HincrFrom(name, key, 5, 100)
+	if err != nil {
+		t.Fatalf("HincrFrom failed: %v", err)
+	}
+	if val != 105 {
+		t.Errorf("expected 105, got %d", val)
+	}
+	if val, err = db.HincrFrom(name, key, 5, 1000); err != nil || val != 110 {
+		t.Errorf("expected stored value to be used, got %d (%v)", val, err)
+	}
+	if _, err = db.HincrFrom(name, []byte("low"), -5, 3); err == nil {
+		t.Errorf("expected overflow error")
+	}
+}
+
 func TestZsetZget(t *testing.T) {
 	db := setupDB(t)
 	defer db.Close()
@@ -94,3 +264,1781 @@ func TestZsetZget(t *testing.T) {
 		t.Errorf("expected 100, got %d", rs)
 	}
 }
+
+func TestHscanDebug(t *testing.T) {
+	db := setupDB(t)
+
+	name := "layout"
+	if err := db.Hmset(name, []byte("a"), []byte("1"), []byte("b"), []byte("2")); err != nil {
+		t.Fatalf("Hmset failed: %v", err)
+	}
+
+	list, err := db.HscanDebug(name, nil, 10)
+	if err != nil {
+		t.Fatalf("HscanDebug failed: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(list))
+	}
+	for _, e := range list {
+		want := sharon.Bconcat([]byte{30}, []byte(name), []byte{28}, e.Key)
+		if !bytes.Equal(e.RawKey, want) {
+			t.Errorf("expected raw key %q, got %q", want, e.RawKey)
+		}
+	}
+	if string(list[0].Key) != "a" || string(list[1].Value) != "2" {
+		t.Errorf("unexpected entries %+v", list)
+	}
+
+	_ = db.Close()
+	if _, err = db.HscanDebug(name, nil, 10); err == nil {
+		t.Errorf("expected error on a closed DB")
+	}
+}
+
+func TestCloseWithTimeout(t *testing.T) {
+	db := setupDB(t)
+
+	db.Go(func(quit <-chan struct{}) {
+		for i := 0; ; i++ {
+			select {
+			case <-quit:
+				return
+			default:
+				_ = db.Hset("reaper", []byte("tick"), sharon.Uint64ToBytes(uint64(i)))
+			}
+		}
+	})
+
+	start := time.Now()
+	if err := db.CloseWithTimeout(time.Second); err != nil {
+		t.Fatalf("CloseWithTimeout failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close took %s", elapsed)
+	}
+	if err := db.Hset("reaper", []byte("tick"), nil); err == nil {
+		t.Errorf("expected write on closed db to fail")
+	}
+}
+
+func TestOnClose(t *testing.T) {
+	db := setupDB(t)
+
+	var calls []string
+	db.OnClose(func() { calls = append(calls, "first") })
+	db.OnClose(func() {
+		calls = append(calls, "second")
+		// leveldb is still open
+		if _, err := db.Has([]byte("k"), nil); err != nil {
+			t.Errorf("expected the DB to be open in callbacks, got %v", err)
+		}
+	})
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	_ = db.Close()
+	if want := []string{"second", "first"}; !slices.Equal(calls, want) {
+		t.Errorf("expected %v, got %v", want, calls)
+	}
+}
+
+func TestCloseWithTimeoutExpired(t *testing.T) {
+	db := setupDB(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	db.Go(func(quit <-chan struct{}) {
+		<-release
+	})
+
+	if err := db.CloseWithTimeout(10 * time.Millisecond); err != sharon.ErrCloseTimeout {
+		t.Errorf("expected ErrCloseTimeout, got %v", err)
+	}
+}
+
+func TestZscores(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "board"
+	_ = db.Zset(name, []byte("alice"), 10)
+	_ = db.Zset(name, []byte("bob"), 0)
+
+	scores, err := db.Zscores(name, [][]byte{[]byte("alice"), []byte("carol"), []byte("bob")})
+	if err != nil {
+		t.Fatalf("Zscores failed: %v", err)
+	}
+	if len(scores) != 2 {
+		t.Fatalf("expected 2 scores, got %v", scores)
+	}
+	if scores["alice"] != 10 {
+		t.Errorf("expected alice=10, got %d", scores["alice"])
+	}
+	if score, ok := scores["bob"]; !ok || score != 0 {
+		t.Errorf("expected bob=0, got %d (%v)", score, ok)
+	}
+	if _, ok := scores["carol"]; ok {
+		t.Errorf("expected carol to be omitted")
+	}
+}
+
+func TestHmdelCount(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "mdel"
+	if err := db.Hmset(name, []byte("a"), []byte("1"), []byte("b"), []byte("2"), []byte("c"), []byte("3")); err != nil {
+		t.Fatalf("Hmset failed: %v", err)
+	}
+
+	deleted, err := db.HmdelCount(name, [][]byte{[]byte("a"), []byte("x"), []byte("c"), []byte("a")})
+	if err != nil {
+		t.Fatalf("HmdelCount failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("expected 2 deleted, got %d", deleted)
+	}
+	if db.HhasKey(name, []byte("a")) || db.HhasKey(name, []byte("c")) {
+		t.Errorf("expected a and c to be deleted")
+	}
+	if !db.HhasKey(name, []byte("b")) {
+		t.Errorf("expected b to survive")
+	}
+}
+
+func TestZjoinFunc(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	_ = db.Zset("za", []byte("a"), 1)
+	_ = db.Zset("za", []byte("b"), 2)
+	_ = db.Zset("zb", []byte("b"), 20)
+	_ = db.Zset("zb", []byte("c"), 30)
+
+	type row struct {
+		key            string
+		scoreA, scoreB uint64
+		inA, inB       bool
+	}
+	var rows []row
+	err := db.ZjoinFunc("za", "zb", func(key []byte, scoreA, scoreB uint64, inA, inB bool) bool {
+		rows = append(rows, row{string(key), scoreA, scoreB, inA, inB})
+		return true
+	})
+	if err != nil {
+		t.Fatalf("ZjoinFunc failed: %v", err)
+	}
+	want := []row{
+		{"a", 1, 0, true, false},
+		{"b", 2, 20, true, true},
+		{"c", 0, 30, false, true},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %v, got %v", want, rows)
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("row %d: expected %v, got %v", i, want[i], rows[i])
+		}
+	}
+
+	n := 0
+	_ = db.ZjoinFunc("za", "zb", func(key []byte, scoreA, scoreB uint64, inA, inB bool) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("expected join to stop after 1 call, got %d", n)
+	}
+}
+
+func TestHmexists(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "sync"
+	if err := db.Hmset(name, []byte("a"), []byte("1"), []byte("c"), []byte("")); err != nil {
+		t.Fatalf("Hmset failed: %v", err)
+	}
+
+	exists, err := db.Hmexists(name, [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("a"), []byte("b")})
+	if err != nil {
+		t.Fatalf("Hmexists failed: %v", err)
+	}
+	want := []bool{true, false, true, true, false}
+	if len(exists) != len(want) {
+		t.Fatalf("expected %v, got %v", want, exists)
+	}
+	for i := range want {
+		if exists[i] != want[i] {
+			t.Errorf("index %d: expected %v, got %v", i, want[i], exists[i])
+		}
+	}
+}
+
+func TestHdelBucketCtx(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "huge"
+	kvs := make([][]byte, 0, 5000)
+	for i := 0; i < 2500; i++ {
+		kvs = append(kvs, sharon.Uint64ToBytes(uint64(i)), []byte("v"))
+	}
+	if err := db.Hmset(name, kvs...); err != nil {
+		t.Fatalf("Hmset failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	deleted, err := db.HdelBucketCtx(ctx, name, func(deleted int64) {
+		calls++
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 progress call, got %d", calls)
+	}
+	if deleted <= 0 || deleted >= 2500 {
+		t.Fatalf("expected a partial delete, got %d", deleted)
+	}
+
+	left := db.Hscan(name, nil, 0).KvLen()
+	if int64(left) != 2500-deleted {
+		t.Errorf("expected %d keys left, got %d", 2500-deleted, left)
+	}
+
+	deleted, err = db.HdelBucketCtx(context.Background(), name, nil)
+	if err != nil {
+		t.Fatalf("HdelBucketCtx failed: %v", err)
+	}
+	if int(deleted) != left {
+		t.Errorf("expected %d deleted, got %d", left, deleted)
+	}
+}
+
+func TestHlog(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "events"
+	for i, v := range []string{"one", "two", "three"} {
+		seq, err := db.HlogAppend(name, []byte("a"), []byte(v))
+		if err != nil {
+			t.Fatalf("HlogAppend failed: %v", err)
+		}
+		if seq != uint64(i+1) {
+			t.Errorf("expected seq %d, got %d", i+1, seq)
+		}
+	}
+	if _, err := db.HlogAppend(name, []byte("b"), []byte("other")); err != nil {
+		t.Fatalf("HlogAppend failed: %v", err)
+	}
+
+	rs := db.HlogRange(name, []byte("a"), 0)
+	if !rs.OK() {
+		t.Fatalf("HlogRange failed: %s", rs.State)
+	}
+	list := rs.List()
+	if len(list) != 3 {
+		t.Fatalf("expected 3 log entries, got %d", len(list))
+	}
+	for i, v := range []string{"one", "two", "three"} {
+		if list[i].Key.Uint64() != uint64(i+1) || list[i].Value.String() != v {
+			t.Errorf("entry %d: expected %d=%s, got %d=%s", i, i+1, v, list[i].Key.Uint64(), list[i].Value)
+		}
+	}
+
+	list = db.HlogRange(name, []byte("b"), 0).List()
+	if len(list) != 1 || list[0].Value.String() != "other" {
+		t.Errorf("expected separate log for b, got %v", list)
+	}
+}
+
+func TestZincrClamp(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "reputation"
+	key := []byte("user")
+	_ = db.Zset(name, key, 990)
+
+	score, err := db.ZincrClamp(name, key, 50, 0, 1000)
+	if err != nil {
+		t.Fatalf("ZincrClamp failed: %v", err)
+	}
+	if score != 1000 || db.Zget(name, key) != 1000 {
+		t.Errorf("expected clamp to 1000, got %d", score)
+	}
+
+	score, err = db.ZincrClamp(name, key, -5000, 10, 1000)
+	if err != nil {
+		t.Fatalf("ZincrClamp failed: %v", err)
+	}
+	if score != 10 || db.Zget(name, key) != 10 {
+		t.Errorf("expected clamp to 10, got %d", score)
+	}
+
+	if rs := db.Zscan(name, nil, nil, 0); rs.KvLen() != 1 {
+		t.Errorf("expected a single index entry, got %d", rs.KvLen())
+	}
+}
+
+func TestZincrExisting(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "votes"
+	if _, err := db.ZincrExisting(name, []byte("ghost"), 1); !errors.Is(err, leveldb.ErrNotFound) {
+		t.Errorf("expected ErrNotFound on missing member, got %v", err)
+	}
+	if db.ZhasKey(name, []byte("ghost")) {
+		t.Errorf("expected missing member not to be created")
+	}
+
+	_ = db.Zset(name, []byte("post"), 10)
+	score, err := db.ZincrExisting(name, []byte("post"), 5)
+	if err != nil {
+		t.Fatalf("ZincrExisting failed: %v", err)
+	}
+	if score != 15 || db.Zget(name, []byte("post")) != 15 {
+		t.Errorf("expected 15, got %d", score)
+	}
+	if _, err = db.ZincrExisting(name, []byte("post"), -20); err == nil {
+		t.Errorf("expected overflow error")
+	}
+	if rs := db.Zscan(name, nil, nil, 0); rs.KvLen() != 1 {
+		t.Errorf("expected a single index entry, got %d", rs.KvLen())
+	}
+}
+
+func TestZtransfer(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "gifts"
+	_ = db.Zset(name, []byte("alice"), 100)
+	_ = db.Zset(name, []byte("bob"), 50)
+
+	if err := db.Ztransfer(name, []byte("alice"), []byte("bob"), 70); err != nil {
+		t.Fatalf("Ztransfer failed: %v", err)
+	}
+	if a, b := db.Zget(name, []byte("alice")), db.Zget(name, []byte("bob")); a != 30 || b != 120 {
+		t.Errorf("expected alice=30 bob=120, got %d %d", a, b)
+	}
+	var order []string
+	db.Zscan(name, nil, nil, 0).KvEach(func(key, _ sharon.BS) {
+		order = append(order, key.String())
+	})
+	if want := []string{"alice", "bob"}; !slices.Equal(order, want) {
+		t.Errorf("expected scan order %v, got %v", want, order)
+	}
+
+	if err := db.Ztransfer(name, []byte("alice"), []byte("bob"), 31); !errors.Is(err, sharon.ErrInsufficientScore) {
+		t.Errorf("expected ErrInsufficientScore, got %v", err)
+	}
+	if a, b := db.Zget(name, []byte("alice")), db.Zget(name, []byte("bob")); a != 30 || b != 120 {
+		t.Errorf("expected scores untouched, got %d %d", a, b)
+	}
+
+	if err := db.Ztransfer(name, []byte("bob"), []byte("carol"), 20); err != nil {
+		t.Fatalf("Ztransfer to a new member failed: %v", err)
+	}
+	if c := db.Zget(name, []byte("carol")); c != 20 {
+		t.Errorf("expected carol=20, got %d", c)
+	}
+	if rs := db.Zscan(name, nil, nil, 0); rs.KvLen() != 3 {
+		t.Errorf("expected 3 index entries, got %d", rs.KvLen())
+	}
+}
+
+func TestZtopN(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "chart"
+	for i, k := range []string{"a", "b", "c", "d", "e", "f"} {
+		_ = db.Zset(name, []byte(k), uint64((i*7)%6))
+	}
+	// scores: a=0 b=1 c=2 d=3 e=4 f=5
+	members := func(rs *sharon.Reply) []string {
+		var out []string
+		rs.KvEach(func(key, _ sharon.BS) {
+			out = append(out, key.String())
+		})
+		return out
+	}
+	if got := members(db.ZtopN(name, 3, false)); !slices.Equal(got, []string{"f", "e", "d"}) {
+		t.Errorf("expected f e d, got %v", got)
+	}
+	rs := db.ZtopN(name, 3, true)
+	if got := members(rs); !slices.Equal(got, []string{"d", "e", "f"}) {
+		t.Errorf("expected d e f, got %v", got)
+	}
+	if sharon.BytesToScore(rs.Data[1]) != 3 || sharon.BytesToScore(rs.Data[5]) != 5 {
+		t.Errorf("expected scores to follow their keys, got %v", rs.Data)
+	}
+	if got := members(db.ZtopN(name, 0, true)); len(got) != 6 || got[0] != "a" {
+		t.Errorf("expected the whole zset ascending, got %v", got)
+	}
+}
+
+func TestReplyDebug(t *testing.T) {
+	r := &sharon.Reply{
+		State: "ok",
+		Data:  []sharon.BS{[]byte("key1"), []byte("val1"), []byte("key2"), {0x00, 'a', 0xff}},
+	}
+	want := `OK [key1=val1, key2=\x00a\xff]`
+	if got := r.Debug(); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	db := setupDB(t)
+	defer db.Close()
+	if got := db.Hget("nonexist", []byte("nokey")).Debug(); got != "leveldb: not found []" {
+		t.Errorf("unexpected not found debug string %s", got)
+	}
+}
+
+func TestHscanIntKeys(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "events"
+	for _, ts := range []uint64{1700000300, 1700000100, 255, 1700000200, 1 << 40} {
+		_ = db.Hset(name, sharon.Uint64ToBytes(ts), []byte(strconv.FormatUint(ts, 10)))
+	}
+	_ = db.Hset(name, []byte("label"), []byte("not an int"))
+
+	entries, err := db.HscanIntKeys(name, 1700000100, 0)
+	if err != nil {
+		t.Fatalf("HscanIntKeys failed: %v", err)
+	}
+	want := []uint64{1700000100, 1700000200, 1700000300, 1 << 40}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(entries))
+	}
+	for i, w := range want {
+		if entries[i].Key != w || string(entries[i].Value) != strconv.FormatUint(w, 10) {
+			t.Errorf("position %d: expected %d, got %d=%s", i, w, entries[i].Key, entries[i].Value)
+		}
+	}
+
+	if entries, err = db.HscanIntKeys(name, 0, 2); err != nil || len(entries) != 2 || entries[0].Key != 255 {
+		t.Errorf("expected 2 entries from 255, got %v (%v)", entries, err)
+	}
+}
+
+func TestHscanNumeric(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "counters"
+	_, _ = db.Hincr(name, []byte("clicks"), 42)
+	_, _ = db.Hincr(name, []byte("views"), 1000)
+	_ = db.Hset(name, []byte("label"), []byte("not a number"))
+	_ = db.Hset(name, []byte("zeros"), sharon.Uint64ToBytes(0))
+
+	entries, err := db.HscanNumeric(name, nil, 0)
+	if err != nil {
+		t.Fatalf("HscanNumeric failed: %v", err)
+	}
+	want := []struct {
+		Key   string
+		Value uint64
+	}{{"clicks", 42}, {"views", 1000}, {"zeros", 0}}
+	if !slices.Equal(entries, want) {
+		t.Errorf("expected %v, got %v", want, entries)
+	}
+
+	entries, err = db.HscanNumeric(name, []byte("clicks"), 1)
+	if err != nil || len(entries) != 1 || entries[0].Key != "views" {
+		t.Errorf("expected views after clicks with limit 1, got %v %v", entries, err)
+	}
+}
+
+func TestSetMaxReplyBytes(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "huge"
+	for i := 0; i < 1000; i++ {
+		_ = db.Hset(name, sharon.Uint64ToBytes(uint64(i)), make([]byte, 92))
+		_ = db.Zset(name, sharon.Uint64ToBytes(uint64(i)), uint64(i))
+	}
+
+	db.SetMaxReplyBytes(1000)
+	rs := db.Hscan(name, nil, 0)
+	if rs.OK() || rs.State != "reply size limit exceeded" {
+		t.Errorf("expected size limit state, got %s", rs.State)
+	}
+	if rs.KvLen() != 10 {
+		t.Errorf("expected the 10 entries fitting in 1000 bytes, got %d", rs.KvLen())
+	}
+	if rs = db.Zscan(name, nil, nil, 0); rs.OK() || rs.KvLen() != 62 {
+		t.Errorf("expected zscan to stop after 62 members, got %d (%s)", rs.KvLen(), rs.State)
+	}
+	if rs = db.Hscan(name, nil, 5); !rs.OK() || rs.KvLen() != 5 {
+		t.Errorf("expected small scan to succeed, got %d (%s)", rs.KvLen(), rs.State)
+	}
+
+	db.SetMaxReplyBytes(0)
+	if rs = db.Hscan(name, nil, 0); !rs.OK() || rs.KvLen() != 1000 {
+		t.Errorf("expected uncapped scan to return 1000 entries, got %d (%s)", rs.KvLen(), rs.State)
+	}
+}
+
+func TestHscanFrom(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "bounds"
+	_ = db.Hmset(name, []byte("a"), []byte("1"), []byte("b"), []byte("2"), []byte("c"), []byte("3"))
+
+	keys := func(rs *sharon.Reply) []string {
+		var out []string
+		rs.KvEach(func(key, _ sharon.BS) {
+			out = append(out, key.String())
+		})
+		return out
+	}
+	if got := keys(db.HscanFrom(name, []byte("b"), true, 0)); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("expected inclusive scan [b c], got %v", got)
+	}
+	if got := keys(db.HscanFrom(name, []byte("b"), false, 0)); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("expected exclusive scan [c], got %v", got)
+	}
+	if got := keys(db.HscanFrom(name, []byte("bb"), true, 0)); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("expected scan from a missing key [c], got %v", got)
+	}
+	if got := keys(db.HscanFrom(name, []byte("a"), true, 1)); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("expected inclusive scan with limit 1 [a], got %v", got)
+	}
+}
+
+func TestHscanChan(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "stream"
+	for i := 0; i < 100; i++ {
+		_ = db.Hset(name, sharon.Uint64ToBytes(uint64(i)), []byte("v"))
+	}
+	before := runtime.NumGoroutine()
+
+	ch, cancel := db.HscanChan(name, nil, 4)
+	for i := 0; i < 10; i++ {
+		e, ok := <-ch
+		if !ok {
+			t.Fatalf("channel closed after %d entries", i)
+		}
+		if sharon.BytesToUint64(e.Key) != uint64(i) {
+			t.Errorf("expected key %d, got %d", i, sharon.BytesToUint64(e.Key))
+		}
+	}
+	cancel()
+	cancel()
+
+	rest := 0
+	for range ch {
+		rest++
+	}
+	if rest > 5 {
+		t.Errorf("expected at most the buffered entries after cancel, got %d", rest)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("expected scan goroutine to exit, goroutines %d -> %d", before, after)
+	}
+
+	n := 0
+	ch, cancel = db.HscanChan(name, sharon.Uint64ToBytes(uint64(89)), 0)
+	defer cancel()
+	for range ch {
+		n++
+	}
+	if n != 10 {
+		t.Errorf("expected 10 entries after key 89, got %d", n)
+	}
+}
+
+func TestReplyColumns(t *testing.T) {
+	r := &sharon.Reply{
+		State: "ok",
+		Data:  []sharon.BS{[]byte("k1"), []byte("v1"), []byte("k2"), []byte("v2"), []byte("dangling")},
+	}
+	keys, values := r.Columns()
+	if len(keys) != 2 || len(values) != 2 {
+		t.Fatalf("expected 2 aligned pairs, got %d keys and %d values", len(keys), len(values))
+	}
+	for i := range keys {
+		if keys[i].String() != "k"+strconv.Itoa(i+1) || values[i].String() != "v"+strconv.Itoa(i+1) {
+			t.Errorf("pair %d: got %s=%s", i, keys[i], values[i])
+		}
+	}
+	if &keys[1][0] != &r.Data[2][0] {
+		t.Errorf("expected columns to share the reply bytes")
+	}
+
+	keys, values = (&sharon.Reply{}).Columns()
+	if len(keys) != 0 || len(values) != 0 {
+		t.Errorf("expected empty columns")
+	}
+}
+
+func TestReplyJoinValues(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 100)
+	var keys [][]byte
+	for i := 0; i*256 < len(blob); i++ {
+		key := []byte(fmt.Sprintf("part%03d", i))
+		_ = db.Hset("blobs", key, blob[i*256:min(len(blob), (i+1)*256)])
+		keys = append(keys, key)
+	}
+	if got := db.Hmget("blobs", keys).JoinValues(); !bytes.Equal(got, blob) {
+		t.Errorf("expected the reassembled blob, got %d bytes", len(got))
+	}
+	if got := (&sharon.Reply{}).JoinValues(); len(got) != 0 {
+		t.Errorf("expected nothing from an empty reply, got %q", got)
+	}
+
+	// values-only replies are joined whole with JoinAll, whatever their length
+	if got := db.Hget("blobs", keys[0]).JoinAll(); !bytes.Equal(got, blob[:256]) {
+		t.Errorf("expected the first chunk from Hget, got %q", got)
+	}
+	values := &sharon.Reply{Data: []sharon.BS{[]byte("a"), []byte("b")}}
+	if got := string(values.JoinAll()); got != "ab" {
+		t.Errorf("expected ab from two values, got %q", got)
+	}
+}
+
+func TestReplyMarshalJSON(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "json"
+	if err := db.Hmset(name, []byte("a"), []byte("1"), []byte("b"), []byte("two")); err != nil {
+		t.Fatalf("Hmset failed: %v", err)
+	}
+	got, err := json.Marshal(db.Hscan(name, nil, 10))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if want := `{"ok":true,"data":{"a":"1","b":"two"}}`; string(got) != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	got, err = json.Marshal(db.Hget(name, []byte("missing")))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if want := `{"ok":false,"notFound":true}`; string(got) != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	r := &sharon.Reply{State: "ok", Data: []sharon.BS{{0xff, 0x00, 0x01}}}
+	got, err = json.Marshal(r)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if want := `{"ok":true,"data":["/wAB"]}`; string(got) != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	key := []byte("cnt")
+	if _, err := db.Hincr("counter", key, 100); err != nil {
+		t.Fatalf("Hincr failed: %v", err)
+	}
+
+	val, err := db.Incr(key, 5)
+	if err != nil {
+		t.Fatalf("Incr failed: %v", err)
+	}
+	if val != 5 {
+		t.Errorf("expected 5, got %d", val)
+	}
+	if val, err = db.Incr(key, -2); err != nil || val != 3 {
+		t.Errorf("expected 3, got %d (%v)", val, err)
+	}
+	if _, err = db.Incr(key, -4); err == nil {
+		t.Errorf("expected overflow error")
+	}
+	if got := db.GetInt(key); got != 3 {
+		t.Errorf("expected flat counter 3, got %d", got)
+	}
+	if got := db.HgetInt("counter", key); got != 100 {
+		t.Errorf("expected hash counter 100, got %d", got)
+	}
+}
+
+func TestHchildren(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "t"
+	for _, k := range []string{"a/b", "a/c", "a/c/d", "a/c/e", "e/f"} {
+		if err := db.Hset(name, []byte(k), []byte("v")); err != nil {
+			t.Fatalf("Hset failed: %v", err)
+		}
+	}
+
+	rs := db.Hchildren(name, []byte("a/"), '/', 0)
+	if !rs.OK() {
+		t.Fatalf("Hchildren failed: %s", rs.State)
+	}
+	if len(rs.Data) != 2 || rs.Data[0].String() != "b" || rs.Data[1].String() != "c" {
+		t.Errorf("expected [b c], got %q", rs.Data)
+	}
+
+	rs = db.Hchildren(name, nil, '/', 0)
+	if len(rs.Data) != 2 || rs.Data[0].String() != "a" || rs.Data[1].String() != "e" {
+		t.Errorf("expected [a e], got %q", rs.Data)
+	}
+}
+
+func TestNextPrefix(t *testing.T) {
+	cases := []struct {
+		p, want []byte
+	}{
+		{[]byte("abc"), []byte("abd")},
+		{[]byte{'a', 0xff}, []byte{'b'}},
+		{[]byte{'a', 0xfe, 0xff, 0xff}, []byte{'a', 0xff}},
+		{[]byte{0xff, 0xff}, nil},
+		{nil, nil},
+	}
+	for _, c := range cases {
+		got := sharon.NextPrefix(c.p)
+		if !bytes.Equal(got, c.want) || (got == nil) != (c.want == nil) {
+			t.Errorf("NextPrefix(%x): expected %x, got %x", c.p, c.want, got)
+		}
+		if c.p != nil && !bytes.Equal(got, util.BytesPrefix(c.p).Limit) {
+			t.Errorf("NextPrefix(%x): expected to match util.BytesPrefix, got %x", c.p, got)
+		}
+	}
+}
+
+func TestScoreToBytes(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "scores"
+	for i, k := range []string{"a", "b", "c", "d"} {
+		_ = db.Zset(name, []byte(k), uint64(i+1)*10)
+	}
+
+	if got := sharon.BytesToScore(sharon.ScoreToBytes(1234)); got != 1234 {
+		t.Errorf("expected round trip 1234, got %d", got)
+	}
+
+	list := db.Zscan(name, nil, sharon.ScoreToBytes(20), 0).List()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 members above score 20, got %d", len(list))
+	}
+	if list[0].Key.String() != "c" || sharon.BytesToScore(list[0].Value) != 30 {
+		t.Errorf("expected scan to start at c=30, got %s=%d", list[0].Key, sharon.BytesToScore(list[0].Value))
+	}
+}
+
+func TestHgetStrict(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "critical"
+	_ = db.Hset(name, []byte("k"), []byte("v"))
+	if err := db.CompactRange(util.Range{}); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+
+	rs := db.HgetStrict(name, []byte("k"))
+	if !rs.OK() || rs.String() != db.Hget(name, []byte("k")).String() {
+		t.Errorf("expected strict read to match Hget, got %s", rs.Debug())
+	}
+	if rs = db.HgetStrict(name, []byte("missing")); !rs.NotFound() {
+		t.Errorf("expected not found, got %s", rs.State)
+	}
+}
+
+func TestHduplicate(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "templates"
+	_ = db.Hset(name, []byte("base"), []byte("template"))
+	_ = db.Hset(name, []byte("taken"), []byte("mine"))
+
+	ok, err := db.Hduplicate(name, []byte("base"), []byte("copy"), false)
+	if err != nil || !ok {
+		t.Fatalf("expected duplicate to succeed, got %v (%v)", ok, err)
+	}
+	for _, key := range []string{"base", "copy"} {
+		if got := db.Hget(name, []byte(key)).String(); got != "template" {
+			t.Errorf("expected %s to hold template, got %q", key, got)
+		}
+	}
+
+	if ok, _ = db.Hduplicate(name, []byte("base"), []byte("taken"), false); ok {
+		t.Errorf("expected existing destination to be protected")
+	}
+	if got := db.Hget(name, []byte("taken")).String(); got != "mine" {
+		t.Errorf("expected protected destination to keep mine, got %q", got)
+	}
+	if ok, _ = db.Hduplicate(name, []byte("base"), []byte("taken"), true); !ok {
+		t.Errorf("expected overwrite to succeed")
+	}
+	if got := db.Hget(name, []byte("taken")).String(); got != "template" {
+		t.Errorf("expected overwritten destination, got %q", got)
+	}
+
+	if ok, err = db.Hduplicate(name, []byte("missing"), []byte("x"), true); ok || err != nil {
+		t.Errorf("expected missing source to report false, got %v (%v)", ok, err)
+	}
+}
+
+func TestHsetBucketAtomic(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "config"
+	_ = db.Hmset(name, []byte("old1"), []byte("x"), []byte("keep"), []byte("old"), []byte("old2"), []byte("y"))
+	_ = db.Hset("other", []byte("old1"), []byte("untouched"))
+
+	err := db.HsetBucketAtomic(name, map[string][]byte{
+		"keep": []byte("new"),
+		"new1": []byte("1"),
+		"new2": []byte("2"),
+	})
+	if err != nil {
+		t.Fatalf("HsetBucketAtomic failed: %v", err)
+	}
+
+	var got []string
+	db.Hscan(name, nil, 0).KvEach(func(key, value sharon.BS) {
+		got = append(got, key.String()+"="+value.String())
+	})
+	if want := []string{"keep=new", "new1=1", "new2=2"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if db.Hget("other", []byte("old1")).String() != "untouched" {
+		t.Errorf("expected other hashmaps to be untouched")
+	}
+
+	if err = db.HsetBucketAtomic(name, nil); err != nil {
+		t.Fatalf("HsetBucketAtomic failed: %v", err)
+	}
+	if rs := db.Hscan(name, nil, 0); rs.OK() {
+		t.Errorf("expected empty hashmap, got %s", rs.Debug())
+	}
+}
+
+func TestHsetCapped(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "blobs"
+	if err := db.HsetCapped(name, []byte("small"), []byte("abc"), 4); err != nil {
+		t.Errorf("expected under-limit write to succeed, got %v", err)
+	}
+	if err := db.HsetCapped(name, []byte("exact"), []byte("abcd"), 4); err != nil {
+		t.Errorf("expected at-limit write to succeed, got %v", err)
+	}
+	if err := db.HsetCapped(name, []byte("big"), []byte("abcde"), 4); err != sharon.ErrValueTooLarge {
+		t.Errorf("expected ErrValueTooLarge, got %v", err)
+	}
+	if !db.Hget(name, []byte("big")).NotFound() {
+		t.Errorf("expected rejected value not to be written")
+	}
+	if got := db.Hget(name, []byte("exact")).String(); got != "abcd" {
+		t.Errorf("expected abcd, got %q", got)
+	}
+
+	if err := db.HsetTruncated(name, []byte("big"), []byte("abcde"), 4); err != nil {
+		t.Fatalf("HsetTruncated failed: %v", err)
+	}
+	if got := db.Hget(name, []byte("big")).String(); got != "abcd" {
+		t.Errorf("expected truncated value abcd, got %q", got)
+	}
+}
+
+func TestHreplace(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "replace"
+	key := []byte("k")
+
+	replaced, err := db.Hreplace(name, key, []byte("v1"))
+	if err != nil || replaced {
+		t.Fatalf("expected no replace on missing key, got %v (%v)", replaced, err)
+	}
+	if db.HhasKey(name, key) {
+		t.Fatalf("expected Hreplace not to create the key")
+	}
+
+	_ = db.Hset(name, key, []byte("v1"))
+	replaced, err = db.Hreplace(name, key, []byte("v2"))
+	if err != nil || !replaced {
+		t.Fatalf("expected replace on existing key, got %v (%v)", replaced, err)
+	}
+	if got := db.Hget(name, key).String(); got != "v2" {
+		t.Errorf("expected v2, got %s", got)
+	}
+}
+
+func TestHaggregate(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "metrics"
+	for i, v := range []uint64{7, 3, 10} {
+		_ = db.Hset(name, []byte{byte('a' + i)}, sharon.Uint64ToBytes(v))
+	}
+	_ = db.Hset(name, []byte("text"), []byte("n/a"))
+
+	sum, min, max, count, err := db.Haggregate(name)
+	if err != nil {
+		t.Fatalf("Haggregate failed: %v", err)
+	}
+	if sum != 20 || min != 3 || max != 10 || count != 3 {
+		t.Errorf("expected sum=20 min=3 max=10 count=3, got sum=%d min=%d max=%d count=%d", sum, min, max, count)
+	}
+
+	if _, _, _, count, _ = db.Haggregate("empty"); count != 0 {
+		t.Errorf("expected count 0 on empty bucket, got %d", count)
+	}
+}
+
+func TestZsumZavg(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "avg"
+	for i, v := range []uint64{10, 20, 40} {
+		_ = db.Zset(name, []byte{byte('a' + i)}, v)
+	}
+
+	sum, err := db.Zsum(name)
+	if err != nil || sum != 70 {
+		t.Errorf("expected sum 70, got %d (%v)", sum, err)
+	}
+	avg, err := db.Zavg(name)
+	if err != nil || avg != 70.0/3 {
+		t.Errorf("expected avg %f, got %f (%v)", 70.0/3, avg, err)
+	}
+
+	if sum, err = db.Zsum("none"); err != nil || sum != 0 {
+		t.Errorf("expected empty sum 0, got %d (%v)", sum, err)
+	}
+	if avg, err = db.Zavg("none"); err != nil || avg != 0 {
+		t.Errorf("expected empty avg 0, got %f (%v)", avg, err)
+	}
+
+	_ = db.Zset("big", []byte("a"), math.MaxUint64)
+	_ = db.Zset("big", []byte("b"), math.MaxUint64)
+	if _, err = db.Zsum("big"); err == nil {
+		t.Errorf("expected overflow error")
+	}
+	if avg, err = db.Zavg("big"); err != nil || avg != math.MaxUint64 {
+		t.Errorf("expected avg %v, got %v (%v)", float64(math.MaxUint64), avg, err)
+	}
+}
+
+func TestZpopN(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "jobs"
+	for _, i := range []int{5, 2, 9, 0, 7, 3, 8, 1, 6, 4} {
+		_ = db.Zset(name, []byte{'j', byte('0' + i)}, uint64(i*10))
+	}
+
+	check := func(rs *sharon.Reply, want ...int) {
+		t.Helper()
+		list := rs.List()
+		if len(list) != len(want) {
+			t.Fatalf("expected %d members, got %s", len(want), rs.Debug())
+		}
+		for i, w := range want {
+			if list[i].Key.String() != string([]byte{'j', byte('0' + w)}) || list[i].Value.Uint64() != uint64(w*10) {
+				t.Errorf("position %d: expected j%d=%d, got %s=%d", i, w, w*10, list[i].Key, list[i].Value.Uint64())
+			}
+		}
+	}
+	check(db.ZpopMinN(name, 3), 0, 1, 2)
+	check(db.ZpopMaxN(name, 3), 9, 8, 7)
+	check(db.ZpopMinN(name, 3), 3, 4, 5)
+	check(db.ZpopMaxN(name, 3), 6)
+
+	if rs := db.ZpopMinN(name, 3); rs.OK() {
+		t.Errorf("expected empty zset, got %s", rs.Debug())
+	}
+	if rs := db.Zscan(name, nil, nil, 0); rs.OK() {
+		t.Errorf("expected popped members to be removed, got %s", rs.Debug())
+	}
+}
+
+func TestZhistogram(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "latency"
+	for i, score := range []uint64{0, 3, 9, 10, 15, 42, 49, 50} {
+		_ = db.Zset(name, []byte{byte('a' + i)}, score)
+	}
+
+	hist, err := db.Zhistogram(name, 10)
+	if err != nil {
+		t.Fatalf("Zhistogram failed: %v", err)
+	}
+	want := map[uint64]int64{0: 3, 10: 2, 40: 2, 50: 1}
+	if len(hist) != len(want) {
+		t.Errorf("expected %v, got %v", want, hist)
+	}
+	for bucket, n := range want {
+		if hist[bucket] != n {
+			t.Errorf("bucket %d: expected %d, got %d", bucket, n, hist[bucket])
+		}
+	}
+
+	if _, err = db.Zhistogram(name, 0); err == nil {
+		t.Errorf("expected error for bucket size 0")
+	}
+}
+
+func TestZrename(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	_ = db.Zset("old", []byte("a"), 1)
+	_ = db.Zset("old", []byte("b"), 2)
+	_ = db.Zset("old", []byte("c"), 3)
+	_ = db.Zset("taken", []byte("x"), 9)
+
+	if err := db.Zrename("old", "taken"); err == nil {
+		t.Errorf("expected rename onto a populated zset to fail")
+	}
+	if err := db.Zrename("old", "new"); err != nil {
+		t.Fatalf("Zrename failed: %v", err)
+	}
+
+	rs := db.Zscan("new", nil, nil, 0)
+	if rs.KvLen() != 3 {
+		t.Fatalf("expected 3 members in new, got %s", rs.Debug())
+	}
+	if got := db.Zget("new", []byte("b")); got != 2 {
+		t.Errorf("expected score 2 for b, got %d", got)
+	}
+	if rs = db.Zrscan("new", nil, nil, 1); rs.KvLen() != 1 || rs.Data[0].String() != "c" {
+		t.Errorf("expected score index to be moved, got %s", rs.Debug())
+	}
+	if rs = db.Zscan("old", nil, nil, 0); rs.OK() {
+		t.Errorf("expected old zset to be empty, got %s", rs.Debug())
+	}
+	if got := db.ZgetDefault("old", []byte("a"), 99); got != 99 {
+		t.Errorf("expected a to be gone from old, got %d", got)
+	}
+}
+
+func TestZsetReport(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "joins"
+	existed, old, err := db.ZsetReport(name, []byte("alice"), 10)
+	if err != nil || existed || old != 0 {
+		t.Errorf("expected new member, got existed=%v old=%d (%v)", existed, old, err)
+	}
+	existed, old, err = db.ZsetReport(name, []byte("alice"), 25)
+	if err != nil || !existed || old != 10 {
+		t.Errorf("expected existing member with old score 10, got existed=%v old=%d (%v)", existed, old, err)
+	}
+	if got := db.Zget(name, []byte("alice")); got != 25 {
+		t.Errorf("expected score 25, got %d", got)
+	}
+	if n := db.Zscan(name, nil, nil, 0).KvLen(); n != 1 {
+		t.Errorf("expected a single index entry, got %d", n)
+	}
+}
+
+func TestZincrGC(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "refs"
+	if score, removed, err := db.ZincrGC(name, []byte("obj"), 2); err != nil || score != 2 || removed {
+		t.Fatalf("expected score 2, got %d removed=%v (%v)", score, removed, err)
+	}
+	if score, removed, err := db.ZincrGC(name, []byte("obj"), -1); err != nil || score != 1 || removed {
+		t.Errorf("expected score 1, got %d removed=%v (%v)", score, removed, err)
+	}
+	if rs := db.Zscan(name, nil, nil, 0); rs.KvLen() != 1 {
+		t.Errorf("expected member to stay present, got %s", rs.Debug())
+	}
+
+	score, removed, err := db.ZincrGC(name, []byte("obj"), -1)
+	if err != nil || score != 0 || !removed {
+		t.Errorf("expected removal at zero, got %d removed=%v (%v)", score, removed, err)
+	}
+	if rs := db.Zscan(name, nil, nil, 0); rs.OK() {
+		t.Errorf("expected member to be gone, got %s", rs.Debug())
+	}
+	if got := db.ZgetDefault(name, []byte("obj"), 99); got != 99 {
+		t.Errorf("expected score entry to be gone, got %d", got)
+	}
+	if _, _, err = db.ZincrGC(name, []byte("obj"), -1); err == nil {
+		t.Errorf("expected overflow error below zero")
+	}
+}
+
+func TestRealKeys(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	_ = db.Hset("h", []byte("k"), []byte("v"))
+	_ = db.Zset("z", []byte("m"), 7)
+
+	if got := sharon.HashKey("h", []byte("k")); !bytes.Equal(got, []byte{30, 'h', 28, 'k'}) {
+		t.Errorf("unexpected hash key %q", got)
+	}
+	val, err := db.DB.Get(sharon.HashKey("h", []byte("k")), nil)
+	if err != nil || string(val) != "v" {
+		t.Errorf("expected Hset to write the hash key, got %q (%v)", val, err)
+	}
+
+	score, err := db.DB.Get(sharon.ZsetScoreKey("z", []byte("m")), nil)
+	if err != nil || sharon.BytesToUint64(score) != 7 {
+		t.Errorf("expected Zset to write the score key, got %v (%v)", score, err)
+	}
+	index := sharon.ZsetIndexKey("z", 7, []byte("m"))
+	if has, _ := db.Has(index, nil); !has {
+		t.Errorf("expected Zset to write the index key %q", index)
+	}
+
+	var raw [][]byte
+	iter := db.NewIterator(util.BytesPrefix(sharon.ZsetIndexKey("z", 7, nil)), nil)
+	for iter.Next() {
+		raw = append(raw, append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	if len(raw) != 1 || !bytes.Equal(raw[0], index) {
+		t.Errorf("expected a range built from ZsetIndexKey to find %q, got %q", index, raw)
+	}
+}
+
+func TestZmgetScores(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "ranks"
+	_ = db.Zset(name, []byte("a"), 10)
+	_ = db.Zset(name, []byte("c"), 30)
+
+	keys := [][]byte{[]byte("c"), []byte("missing"), []byte("a"), []byte("c")}
+	scores, found, err := db.ZmgetScores(name, keys)
+	if err != nil {
+		t.Fatalf("ZmgetScores failed: %v", err)
+	}
+	wantScores := []uint64{30, 0, 10, 30}
+	wantFound := []bool{true, false, true, true}
+	if !slices.Equal(scores, wantScores) || !slices.Equal(found, wantFound) {
+		t.Errorf("expected %v %v, got %v %v", wantScores, wantFound, scores, found)
+	}
+}
+
+func TestZswap(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "ladder"
+	_ = db.Zset(name, []byte("a"), 1)
+	_ = db.Zset(name, []byte("b"), 2)
+	_ = db.Zset(name, []byte("c"), 3)
+
+	if err := db.Zswap(name, []byte("a"), []byte("c")); err != nil {
+		t.Fatalf("Zswap failed: %v", err)
+	}
+	if db.Zget(name, []byte("a")) != 3 || db.Zget(name, []byte("c")) != 1 {
+		t.Errorf("expected swapped scores, got a=%d c=%d", db.Zget(name, []byte("a")), db.Zget(name, []byte("c")))
+	}
+
+	list := db.Zscan(name, nil, nil, 0).List()
+	if len(list) != 3 {
+		t.Fatalf("expected 3 members, got %d", len(list))
+	}
+	for i, k := range []string{"c", "b", "a"} {
+		if list[i].Key.String() != k {
+			t.Errorf("position %d: expected %s, got %s", i, k, list[i].Key)
+		}
+	}
+
+	if err := db.Zswap(name, []byte("a"), []byte("missing")); err == nil {
+		t.Errorf("expected error swapping with a missing member")
+	}
+	if db.Zget(name, []byte("a")) != 3 {
+		t.Errorf("expected failed swap to leave a untouched")
+	}
+}
+
+func TestBatchSink(t *testing.T) {
+	primary := setupDB(t)
+	defer primary.Close()
+	standby, err := sharon.Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("failed to open standby: %v", err)
+	}
+	defer standby.Close()
+
+	var dumps [][]byte
+	primary.SetBatchSink(func(batchDump []byte) {
+		dumps = append(dumps, batchDump)
+	})
+
+	_ = primary.Hset("h", []byte("a"), []byte("1"))
+	_ = primary.Hmset("h", []byte("b"), []byte("2"), []byte("c"), []byte("3"))
+	_ = primary.Hdel("h", []byte("b"))
+	_ = primary.Zset("z", []byte("m"), 5)
+	_, _ = primary.Zincr("z", []byte("m"), 2)
+
+	for _, d := range dumps {
+		if err := standby.ApplyBatchDump(d); err != nil {
+			t.Fatalf("ApplyBatchDump failed: %v", err)
+		}
+	}
+
+	want := primary.Hscan("h", nil, 0).Dict()
+	got := standby.Hscan("h", nil, 0).Dict()
+	if len(got) != len(want) || string(got["a"]) != "1" || string(got["c"]) != "3" {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if score := standby.Zget("z", []byte("m")); score != 7 {
+		t.Errorf("expected replicated score 7, got %d", score)
+	}
+	if n := standby.Zscan("z", nil, nil, 0).KvLen(); n != 1 {
+		t.Errorf("expected 1 replicated index entry, got %d", n)
+	}
+}
+
+func TestHgetContext(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	_ = db.Hset("ctx", []byte("k"), []byte("v"))
+	if got := db.HgetContext(context.Background(), "ctx", []byte("k")).String(); got != "v" {
+		t.Errorf("expected v, got %s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rs := db.HgetContext(ctx, "ctx", []byte("k"))
+	if rs.OK() || rs.State != context.Canceled.Error() {
+		t.Errorf("expected context canceled state, got %s", rs.State)
+	}
+}
+
+func TestHscanFilter(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "filter"
+	_ = db.Hmset(name,
+		[]byte("a"), []byte("keep:1"),
+		[]byte("b"), []byte("drop:2"),
+		[]byte("c"), []byte("keep:3"),
+		[]byte("d"), []byte("keep:4"),
+	)
+
+	keep := func(value []byte) bool {
+		return bytes.HasPrefix(value, []byte("keep:"))
+	}
+	list := db.HscanFilter(name, nil, 2, keep).List()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(list))
+	}
+	if list[0].Key.String() != "a" || list[1].Key.String() != "c" || list[1].Value.String() != "keep:3" {
+		t.Errorf("unexpected entries %v", list)
+	}
+
+	if n := db.HscanFilter(name, []byte("a"), 0, keep).KvLen(); n != 2 {
+		t.Errorf("expected 2 matches after a, got %d", n)
+	}
+}
+
+func TestHscanMap(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "docs"
+	_ = db.Hmset(name, []byte("a"), []byte("hdr:hello"), []byte("b"), []byte("hdr:world"), []byte("c"), []byte("hdr:!"))
+
+	upper := func(key, value []byte) (sharon.BS, sharon.BS) {
+		return key, bytes.ToUpper(bytes.TrimPrefix(value, []byte("hdr:")))
+	}
+	var got []string
+	db.HscanMap(name, nil, 2, upper).KvEach(func(key, value sharon.BS) {
+		got = append(got, key.String()+"="+value.String())
+	})
+	if want := []string{"a=HELLO", "b=WORLD"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := db.Hget(name, []byte("a")).String(); got != "hdr:hello" {
+		t.Errorf("expected stored value to be unchanged, got %q", got)
+	}
+}
+
+func TestHscanLargeValues(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "bloat"
+	_ = db.Hmset(name,
+		[]byte("a"), make([]byte, 10),
+		[]byte("b"), make([]byte, 4096),
+		[]byte("c"), make([]byte, 1023),
+		[]byte("d"), make([]byte, 1024),
+		[]byte("e"), []byte{},
+	)
+
+	var keys []string
+	db.HscanLargeValues(name, 1024, 0).KvEach(func(key, value sharon.BS) {
+		keys = append(keys, key.String())
+		if len(value) < 1024 {
+			t.Errorf("unexpected small value of %s", key)
+		}
+	})
+	if !slices.Equal(keys, []string{"b", "d"}) {
+		t.Errorf("expected [b d], got %v", keys)
+	}
+	if n := db.HscanLargeValues(name, 1024, 1).KvLen(); n != 1 {
+		t.Errorf("expected limit 1, got %d", n)
+	}
+}
+
+func TestZmembersByScore(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "histogram"
+	_ = db.Zset(name, []byte("a"), 1)
+	_ = db.Zset(name, []byte("b"), 2)
+	_ = db.Zset(name, []byte("c"), 2)
+	_ = db.Zset(name, []byte("d"), 3)
+
+	list := db.ZmembersByScore(name, []uint64{2, 5, 1}).List()
+	want := []struct {
+		key   string
+		score uint64
+	}{{"b", 2}, {"c", 2}, {"a", 1}}
+	if len(list) != len(want) {
+		t.Fatalf("expected %d members, got %d", len(want), len(list))
+	}
+	for i, w := range want {
+		if list[i].Key.String() != w.key || list[i].Value.Uint64() != w.score {
+			t.Errorf("position %d: expected %s=%d, got %s=%d", i, w.key, w.score, list[i].Key, list[i].Value.Uint64())
+		}
+	}
+
+	if rs := db.ZmembersByScore(name, []uint64{9}); rs.OK() {
+		t.Errorf("expected no members at score 9")
+	}
+}
+
+func TestZrangebylex(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "lex"
+	for _, k := range []string{"apple", "banana", "cherry", "date", "fig"} {
+		_ = db.Zset(name, []byte(k), 0)
+	}
+	_ = db.Zset(name, []byte("blueberry"), 1)
+
+	keys := func(rs *sharon.Reply) []string {
+		var out []string
+		rs.KvEach(func(key, _ sharon.BS) {
+			out = append(out, key.String())
+		})
+		return out
+	}
+	cases := []struct {
+		min, max string
+		limit    int
+		want     []string
+	}{
+		{"banana", "date", 10, []string{"banana", "cherry", "date"}},
+		{"b", "d", 10, []string{"banana", "cherry"}},
+		{"", "c", 10, []string{"apple", "banana"}},
+		{"d", "", 10, []string{"date", "fig"}},
+		{"", "", 2, []string{"apple", "banana"}},
+	}
+	for _, c := range cases {
+		got := keys(db.Zrangebylex(name, 0, []byte(c.min), []byte(c.max), c.limit))
+		if !slices.Equal(got, c.want) {
+			t.Errorf("[%q, %q] limit %d: expected %v, got %v", c.min, c.max, c.limit, c.want, got)
+		}
+	}
+	if rs := db.Zrangebylex(name, 0, []byte("x"), nil, 10); rs.OK() {
+		t.Errorf("expected no members after x")
+	}
+}
+
+func TestZscanPrefix(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "players"
+	scores := map[string]uint64{
+		"eu:anna": 10, "eu:bob": 40, "eu:carl": 25, "eu:dana": 25,
+		"us:eve": 20, "us:fred": 30, "eux": 22,
+	}
+	for k, v := range scores {
+		_ = db.Zset(name, []byte(k), v)
+	}
+
+	check := func() {
+		t.Helper()
+		var got []string
+		db.ZscanPrefix(name, []byte("eu:"), 20, 30, 10).KvEach(func(key, value sharon.BS) {
+			got = append(got, fmt.Sprintf("%s=%d", key, sharon.BytesToScore(value)))
+		})
+		want := []string{"eu:carl=25", "eu:dana=25"}
+		if !slices.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+		if got := db.ZscanPrefix(name, []byte("eu:"), 0, 100, 2).KvLen(); got != 2 {
+			t.Errorf("expected limit of 2, got %d", got)
+		}
+		if rs := db.ZscanPrefix(name, []byte("us:"), 31, 100, 10); rs.OK() {
+			t.Errorf("expected no us members above 30, got %v", rs.Data)
+		}
+	}
+	check()
+	// after compaction the estimates differ, the result must not
+	if _, err := db.CompactAll(); err != nil {
+		t.Fatalf("CompactAll failed: %v", err)
+	}
+	check()
+}
+
+func TestProperty(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	stats, err := db.Property("leveldb.stats")
+	if err != nil || stats == "" {
+		t.Errorf("expected leveldb stats, got %q (%v)", stats, err)
+	}
+	if _, err = db.Property("leveldb.no-such-property"); err == nil {
+		t.Errorf("expected error for an unknown property")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	db := setupDB(t)
+	_ = db.Hset("h", []byte("k"), []byte("v"))
+	if err := db.HealthCheck(); err != nil {
+		t.Errorf("expected healthy DB, got %v", err)
+	}
+	_ = db.Close()
+	if err := db.HealthCheck(); err == nil {
+		t.Errorf("expected error on a closed DB")
+	}
+}
+
+func TestKeyCountByType(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	_ = db.Hmset("h1", []byte("a"), []byte("1"), []byte("b"), []byte("2"))
+	_ = db.Hset("h2", []byte("c"), []byte("3"))
+	_ = db.Zset("z", []byte("m1"), 1)
+	_ = db.Zset("z", []byte("m2"), 2)
+	_, _ = db.Incr([]byte("flat"), 1)
+
+	hash, zsetScore, zsetIndex, flat, err := db.KeyCountByType()
+	if err != nil {
+		t.Fatalf("KeyCountByType failed: %v", err)
+	}
+	if hash != 3 || zsetScore != 2 || zsetIndex != 2 || flat != 1 {
+		t.Errorf("expected 3/2/2/1, got %d/%d/%d/%d", hash, zsetScore, zsetIndex, flat)
+	}
+
+	total, err := db.TotalKeys()
+	if err != nil {
+		t.Fatalf("TotalKeys failed: %v", err)
+	}
+	// the format version meta key is counted too
+	if total != 9 {
+		t.Errorf("expected 9 keys in total, got %d", total)
+	}
+}
+
+func TestCompactAll(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	value := bytes.Repeat([]byte("x"), 512)
+	for _, name := range []string{"a", "b"} {
+		for i := 0; i < 500; i++ {
+			_ = db.Hset(name, sharon.Uint64ToBytes(uint64(i)), value)
+		}
+	}
+	if err := db.CompactRange(util.Range{}); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+	_ = db.HdelBucket("a")
+	for i := 0; i < 450; i++ {
+		_ = db.Hdel("b", sharon.Uint64ToBytes(uint64(i)))
+	}
+
+	res, err := db.CompactAll()
+	if err != nil {
+		t.Fatalf("CompactAll failed: %v", err)
+	}
+	if res.SizeBefore <= 0 || res.SizeAfter >= res.SizeBefore {
+		t.Errorf("expected compaction to shrink the tables, got %d -> %d", res.SizeBefore, res.SizeAfter)
+	}
+
+	if n := db.Hscan("b", nil, 0).KvLen(); n != 50 {
+		t.Errorf("expected 50 remaining entries, got %d", n)
+	}
+	if n := db.Hscan("a", nil, 0).KvLen(); n != 0 {
+		t.Errorf("expected deleted bucket to stay empty, got %d", n)
+	}
+	if err = db.Hset("a", []byte("k"), []byte("v")); err != nil || db.Hget("a", []byte("k")).String() != "v" {
+		t.Errorf("expected DB to stay writable after compaction (%v)", err)
+	}
+}
+
+func TestOpenOrCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fresh")
+	for i, want := range []bool{true, false} {
+		db, created, err := sharon.OpenOrCreate(path, nil)
+		if err != nil {
+			t.Fatalf("OpenOrCreate #%d failed: %v", i, err)
+		}
+		if created != want {
+			t.Errorf("OpenOrCreate #%d: expected created=%v, got %v", i, want, created)
+		}
+		if i == 0 {
+			_ = db.Hset("seed", []byte("k"), []byte("v"))
+		} else if got := db.Hget("seed", []byte("k")).String(); got != "v" {
+			t.Errorf("expected seeded value to persist, got %q", got)
+		}
+		if err = db.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+}
+
+func TestReopen(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	db.SetValueCodec(sharon.GzipCodec{})
+	_ = db.Hset("keep", []byte("k"), []byte("v"))
+	_ = db.Hset("keep", []byte("gone"), []byte("v"))
+	_ = db.HexpireAt("keep", []byte("gone"), time.Now().Add(-time.Second))
+
+	if err := db.Reopen(); err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	if got := db.Hget("keep", []byte("k")).String(); got != "v" {
+		t.Errorf("expected value to survive, got %q", got)
+	}
+	if rs := db.Hget("keep", []byte("gone")); !rs.NotFound() {
+		t.Errorf("expected deadline to survive, got %s", rs.State)
+	}
+	if err := db.Hset("keep", []byte("new"), []byte("w")); err != nil {
+		t.Fatalf("Hset after Reopen failed: %v", err)
+	}
+	raw, err := db.DB.Get(sharon.HashKey("keep", []byte("new")), nil)
+	if err != nil || bytes.Equal(raw, []byte("w")) {
+		t.Errorf("expected the codec to be kept, got %q %v", raw, err)
+	}
+}
+
+func TestOpenSub(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+
+	a, err := sharon.OpenSub(root, "a", nil)
+	if err != nil {
+		t.Fatalf("OpenSub a failed: %v", err)
+	}
+	defer a.Close()
+	b, err := sharon.OpenSub(root, "b", nil)
+	if err != nil {
+		t.Fatalf("OpenSub b failed: %v", err)
+	}
+	defer b.Close()
+
+	_ = a.Hset("h", []byte("k"), []byte("from a"))
+	if rs := b.Hget("h", []byte("k")); !rs.NotFound() {
+		t.Errorf("expected sub databases to be independent, got %s", rs.State)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a")); err != nil {
+		t.Errorf("expected sub database directory: %v", err)
+	}
+}
+
+func TestGetDefault(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	_ = db.Zset("z", []byte("zero"), 0)
+	if got := db.ZgetDefault("z", []byte("zero"), 7); got != 0 {
+		t.Errorf("expected stored score 0, got %d", got)
+	}
+	if got := db.ZgetDefault("z", []byte("missing"), 7); got != 7 {
+		t.Errorf("expected default 7, got %d", got)
+	}
+
+	_ = db.Hset("h", []byte("empty"), []byte{})
+	if got := db.HgetDefault("h", []byte("empty"), []byte("def")); len(got) != 0 {
+		t.Errorf("expected stored empty value, got %q", got)
+	}
+	if got := db.HgetDefault("h", []byte("missing"), []byte("def")); string(got) != "def" {
+		t.Errorf("expected default, got %q", got)
+	}
+}
+
+func TestZaddValidated(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "ingest"
+	members := []sharon.ZEntry{
+		{Key: []byte("a"), Score: 10},
+		{Key: []byte("b"), Score: 500},
+		{Key: []byte("c"), Score: 99},
+		{Key: []byte("d"), Score: 101},
+	}
+	accepted, rejected, err := db.ZaddValidated(name, members, func(score uint64) bool {
+		return score <= 100
+	})
+	if err != nil {
+		t.Fatalf("ZaddValidated failed: %v", err)
+	}
+	if accepted != 2 || rejected != 2 {
+		t.Errorf("expected 2 accepted and 2 rejected, got %d and %d", accepted, rejected)
+	}
+	if !db.ZhasKey(name, []byte("a")) || !db.ZhasKey(name, []byte("c")) {
+		t.Errorf("expected valid members to be added")
+	}
+	if db.ZhasKey(name, []byte("b")) || db.ZhasKey(name, []byte("d")) {
+		t.Errorf("expected invalid members to be skipped")
+	}
+	if n := db.Zrscan(name, nil, nil, 0).KvLen(); n != 2 {
+		t.Errorf("expected 2 index entries, got %d", n)
+	}
+}
+
+func TestFormatVersion(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sharon.Open(dir, nil)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	version, err := db.FormatVersion()
+	if err != nil || version != 1 {
+		t.Fatalf("expected format version 1, got %d (%v)", version, err)
+	}
+	_ = db.Close()
+
+	db, err = sharon.Open(dir, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen db at the same version: %v", err)
+	}
+	// simulate a db written by a newer release
+	if err = db.Put(append([]byte{25}, "version"...), sharon.Uint64ToBytes(2), nil); err != nil {
+		t.Fatalf("failed to write version: %v", err)
+	}
+	_ = db.Close()
+
+	if _, err = sharon.Open(dir, nil); err != sharon.ErrFormatVersion {
+		t.Errorf("expected ErrFormatVersion, got %v", err)
+	}
+}
+
+func TestOddKVCount(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	if err := db.Hmset("odd", []byte("a"), []byte("1"), []byte("b")); !errors.Is(err, sharon.ErrOddKVCount) {
+		t.Errorf("expected ErrOddKVCount from Hmset, got %v", err)
+	}
+	if err := db.Zmset("odd", [][]byte{[]byte("a")}); !errors.Is(err, sharon.ErrOddKVCount) {
+		t.Errorf("expected ErrOddKVCount from Zmset, got %v", err)
+	}
+	if db.HhasKey("odd", []byte("a")) || db.ZhasKey("odd", []byte("a")) {
+		t.Errorf("expected nothing written on odd input")
+	}
+}
+
+// checkCapped fails unless rs was cut short of total entries by the reply size cap.
+func checkCapped(t *testing.T, what string, rs *sharon.Reply, entries, total int) {
+	t.Helper()
+	if rs.State != "reply size limit exceeded" || entries == 0 || entries >= total {
+		t.Errorf("%s: expected some of %d entries and the size limit state, got %d (%s)", what, total, entries, rs.State)
+	}
+}
+
+func TestMaxReplyBytesHashScans(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "capped"
+	for i := 0; i < 100; i++ {
+		_, _ = db.HlogAppend(name, []byte("log"), make([]byte, 92))
+		_ = db.Hset(name, []byte(fmt.Sprintf("dir/%03d/file", i)), make([]byte, 92))
+	}
+	db.SetMaxReplyBytes(1000)
+
+	rs := db.HlogRange(name, []byte("log"), 0)
+	checkCapped(t, "HlogRange", rs, rs.KvLen(), 100)
+	rs = db.HscanSortedByValue(name, 0, false)
+	checkCapped(t, "HscanSortedByValue", rs, rs.KvLen(), 200)
+
+	// children are 3 bytes each
+	db.SetMaxReplyBytes(100)
+	rs = db.Hchildren(name, []byte("dir/"), '/', 0)
+	checkCapped(t, "Hchildren", rs, len(rs.Data), 100)
+}
+
+func TestMaxReplyBytesZsetScans(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	db.SetZsetInsertionOrder(true)
+
+	name := "capped"
+	scores := make([]uint64, 100)
+	for i := range scores {
+		key := bytes.Repeat([]byte{byte('a' + i%26)}, 20+i)
+		_ = db.Zset(name, key, 7)
+		scores[i] = uint64(i)
+	}
+	db.SetMaxReplyBytes(1000)
+
+	rs := db.ZmembersByScore(name, []uint64{7})
+	checkCapped(t, "ZmembersByScore", rs, rs.KvLen(), 100)
+	rs = db.Zrangebylex(name, 7, nil, nil, 0)
+	checkCapped(t, "Zrangebylex", rs, rs.KvLen(), 100)
+	rs = db.ZscanByInsertion(name, 0)
+	checkCapped(t, "ZscanByInsertion", rs, rs.KvLen(), 100)
+
+	// only the members returned are popped
+	rs = db.ZpopMaxN(name, 100)
+	checkCapped(t, "ZpopMaxN", rs, rs.KvLen(), 100)
+	db.SetMaxReplyBytes(0)
+	if left := db.Zrangebylex(name, 7, nil, nil, 0).KvLen(); left != 100-rs.KvLen() {
+		t.Errorf("expected %d members left after the capped pop, got %d", 100-rs.KvLen(), left)
+	}
+}
@@ -0,0 +1,134 @@
+package sharon
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Signed zsets store int64 scores with the sign bit flipped, so that the big endian bytes
+// of negative scores sort before positive ones. Legacy zsets store uint64 scores as is,
+// ZmigrateToSigned converts them.
+
+// migrationDone is the value of a migration marker once a zset is fully migrated,
+// before that the marker holds 0 followed by the last migrated key.
+var migrationDone = []byte{1}
+
+// ZIntEntry a key-score pair of a signed zset.
+type ZIntEntry struct {
+	Key   BS
+	Score int64
+}
+
+// IntScoreToBytes encodes a signed score in its order-preserving form.
+func IntScoreToBytes(score int64) []byte {
+	return Uint64ToBytes(uint64(score) ^ (1 << 63))
+}
+
+// BytesToIntScore decodes a signed score encoded by IntScoreToBytes.
+func BytesToIntScore(b []byte) int64 {
+	return int64(BytesToUint64(b) ^ (1 << 63))
+}
+
+// ZsetInt set the signed score of the key of a signed zset.
+func (db *DB) ZsetInt(name string, key []byte, score int64) error {
+	nameB := StringToBytesNoCopy(name)
+	defer db.lockKey(Bconcat(zetScorePrefix, nameB, splitChar, key))()
+
+	batch := new(leveldb.Batch)
+	if _, err := db.stageZset(batch, nameB, key, IntScoreToBytes(score)); err != nil {
+		return err
+	}
+	return db.write(batch)
+}
+
+// ZscanInt list up to limit key-score pairs of a signed zset from the lowest score.
+func (db *DB) ZscanInt(name string, limit int) ([]ZIntEntry, error) {
+	keyPrefix := Bconcat(zetKeyPrefix, StringToBytesNoCopy(name), splitChar)
+	var entries []ZIntEntry
+	iter := db.newIterator(util.BytesPrefix(keyPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		scoreKey := iter.Key()[len(keyPrefix):]
+		entries = append(entries, ZIntEntry{
+			Key:   append([]byte{}, scoreKey[scoreByteLen+1:]...),
+			Score: BytesToIntScore(scoreKey[:scoreByteLen]),
+		})
+		if len(entries) == limit {
+			break
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ZmigrateToSigned re-encodes the scores of a legacy zset in the signed form, in batches
+// that each move whole members and record the progress, so an interrupted migration
+// resumes where it stopped and a finished one is not applied twice. It fails on a score
+// above math.MaxInt64, which has no signed equivalent.
+func (db *DB) ZmigrateToSigned(name string) error {
+	nameB := StringToBytesNoCopy(name)
+	scorePrefix := Bconcat(zetScorePrefix, nameB, splitChar)
+	marker := zsignedKey(nameB)
+	defer db.lockKey(marker)()
+
+	for {
+		last, err := db.Get(marker, nil)
+		if err != nil && err != errors.ErrNotFound {
+			return err
+		}
+		if bytes.Equal(last, migrationDone) {
+			return nil
+		}
+
+		sliceRange := util.BytesPrefix(scorePrefix)
+		if len(last) > 0 {
+			sliceRange.Start = Bconcat(scorePrefix, last[1:], []byte{0})
+		}
+		batch := new(leveldb.Batch)
+		n := 0
+		var key []byte
+		iter := db.newIterator(sliceRange, nil)
+		for n < deleteChunk && iter.Next() {
+			key = append([]byte{}, iter.Key()[len(scorePrefix):]...)
+			oldScore := iter.Value()
+			score := BytesToUint64(oldScore)
+			if score > math.MaxInt64 {
+				iter.Release()
+				return errors.New("score out of signed range")
+			}
+			newScore := IntScoreToBytes(int64(score))
+			batch.Put(iter.Key(), newScore)
+			batch.Delete(Bconcat(zetKeyPrefix, nameB, splitChar, oldScore, splitChar, key))
+			batch.Put(Bconcat(zetKeyPrefix, nameB, splitChar, newScore, splitChar, key), nil)
+			n++
+		}
+		iter.Release()
+		if err = iter.Error(); err != nil {
+			return err
+		}
+
+		if n < deleteChunk {
+			batch.Put(marker, migrationDone)
+		} else {
+			batch.Put(marker, Bconcat([]byte{0}, key))
+		}
+		if err = db.write(batch); err != nil {
+			return err
+		}
+		if n < deleteChunk {
+			return nil
+		}
+	}
+}
+
+// zsignedKey is the key of the migration progress of a zset, ZdelBucket deletes it and
+// Zrename moves it with the members.
+func zsignedKey(nameB []byte) []byte {
+	return Bconcat(metaPrefix, []byte("zsigned"), splitChar, nameB)
+}
@@ -0,0 +1,86 @@
+package sharon_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestZmigrateToSigned(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "temps"
+	for i := 0; i < 2500; i++ {
+		_ = db.Zset(name, sharon.Uint64ToBytes(uint64(i)), uint64(2500-i))
+	}
+	if err := db.ZmigrateToSigned(name); err != nil {
+		t.Fatalf("ZmigrateToSigned failed: %v", err)
+	}
+	// a second run must not re-encode the migrated scores
+	if err := db.ZmigrateToSigned(name); err != nil {
+		t.Fatalf("second ZmigrateToSigned failed: %v", err)
+	}
+
+	_ = db.ZsetInt(name, []byte("cold"), -40)
+	_ = db.ZsetInt(name, []byte("freezing"), -5)
+
+	entries, err := db.ZscanInt(name, 0)
+	if err != nil {
+		t.Fatalf("ZscanInt failed: %v", err)
+	}
+	if len(entries) != 2502 {
+		t.Fatalf("expected 2502 members, got %d", len(entries))
+	}
+	if entries[0].Key.String() != "cold" || entries[0].Score != -40 ||
+		entries[1].Key.String() != "freezing" || entries[1].Score != -5 {
+		t.Errorf("expected negative scores first, got %s=%d, %s=%d",
+			entries[0].Key, entries[0].Score, entries[1].Key, entries[1].Score)
+	}
+	for i, e := range entries[2:] {
+		if e.Score != int64(i+1) || sharon.BytesToUint64(e.Key) != uint64(2500-i-1) {
+			t.Fatalf("position %d: unexpected member %d=%d", i+2, sharon.BytesToUint64(e.Key), e.Score)
+		}
+	}
+	if got := sharon.BytesToIntScore(sharon.IntScoreToBytes(math.MinInt64)); got != math.MinInt64 {
+		t.Errorf("expected round trip of MinInt64, got %d", got)
+	}
+
+	_ = db.Zset("huge", []byte("x"), math.MaxUint64)
+	if err = db.ZmigrateToSigned("huge"); err == nil {
+		t.Errorf("expected error for a score above MaxInt64")
+	}
+}
+
+func TestZmigrateToSignedDeleteRename(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	// a recreated zset starts a fresh migration
+	name := "readings"
+	_ = db.Zset(name, []byte("a"), 7)
+	_ = db.ZmigrateToSigned(name)
+	_ = db.ZdelBucket(name)
+	_ = db.Zset(name, []byte("b"), 9)
+	if err := db.ZmigrateToSigned(name); err != nil {
+		t.Fatalf("ZmigrateToSigned failed: %v", err)
+	}
+	if entries, _ := db.ZscanInt(name, 0); len(entries) != 1 || entries[0].Score != 9 {
+		t.Errorf("expected the recreated zset to be migrated, got %v", entries)
+	}
+
+	// the progress moves with the members, the migrated zset is not re-encoded
+	if err := db.Zrename(name, "renamed"); err != nil {
+		t.Fatalf("Zrename failed: %v", err)
+	}
+	_ = db.ZmigrateToSigned("renamed")
+	if entries, _ := db.ZscanInt("renamed", 0); len(entries) != 1 || entries[0].Score != 9 {
+		t.Errorf("expected the renamed zset to stay migrated, got %v", entries)
+	}
+	_ = db.Zset(name, []byte("c"), 3)
+	_ = db.ZmigrateToSigned(name)
+	if entries, _ := db.ZscanInt(name, 0); len(entries) != 1 || entries[0].Score != 3 {
+		t.Errorf("expected a zset reusing the old name to be migrated, got %v", entries)
+	}
+}
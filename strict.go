@@ -0,0 +1,59 @@
+package sharon
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// ErrEmptyName is returned in strict names mode by bucket methods given an empty name.
+var ErrEmptyName = errors.New("empty bucket name")
+
+// SetStrictNames makes bucket methods reject an empty hashmap or zset name with ErrEmptyName.
+// It is enforced where keys are written, on hashmap point reads and on scans, so methods
+// reporting errors through a Reply carry it as State. Other reads of an empty name find
+// nothing. It is off by default, which keeps accepting empty names. It must be set before
+// the DB is used concurrently.
+func (db *DB) SetStrictNames(strict bool) {
+	db.strictNames = strict
+}
+
+// emptyName reports whether key belongs to a hashmap or zset with an empty name,
+// including the deadline of such a key.
+func emptyName(key []byte) bool {
+	key = bytes.TrimPrefix(key, ttlPrefix)
+	if len(key) < 2 || key[1] != splitChar[0] {
+		return false
+	}
+	switch key[0] {
+	case hashPrefix[0], zetScorePrefix[0], zetKeyPrefix[0]:
+		return true
+	}
+	return false
+}
+
+// nameChecker finds the first key of a batch with an empty bucket name.
+type nameChecker struct {
+	found bool
+}
+
+func (c *nameChecker) Put(key, _ []byte) {
+	c.found = c.found || emptyName(key)
+}
+
+func (c *nameChecker) Delete(key []byte) {
+	c.found = c.found || emptyName(key)
+}
+
+// checkNames returns ErrEmptyName if batch writes a key with an empty bucket name.
+func checkNames(batch *leveldb.Batch) error {
+	var c nameChecker
+	if err := batch.Replay(&c); err != nil {
+		return err
+	}
+	if c.found {
+		return ErrEmptyName
+	}
+	return nil
+}
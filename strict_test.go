@@ -0,0 +1,51 @@
+package sharon_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestStrictNames(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	// lenient by default, an empty name is an ordinary bucket
+	if err := db.Hset("", []byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Hset failed: %v", err)
+	}
+	if err := db.Zset("", []byte("k"), 1); err != nil {
+		t.Fatalf("Zset failed: %v", err)
+	}
+	if got := db.Hget("", []byte("k")).String(); got != "v" {
+		t.Errorf("expected v, got %q", got)
+	}
+
+	db.SetStrictNames(true)
+	if err := db.Hset("", []byte("k"), []byte("w")); !errors.Is(err, sharon.ErrEmptyName) {
+		t.Errorf("expected ErrEmptyName from Hset, got %v", err)
+	}
+	if err := db.Zset("", []byte("k"), 2); !errors.Is(err, sharon.ErrEmptyName) {
+		t.Errorf("expected ErrEmptyName from Zset, got %v", err)
+	}
+	if err := db.Hdel("", []byte("k")); !errors.Is(err, sharon.ErrEmptyName) {
+		t.Errorf("expected ErrEmptyName from Hdel, got %v", err)
+	}
+	if rs := db.Hget("", []byte("k")); rs.State != sharon.ErrEmptyName.Error() {
+		t.Errorf("expected ErrEmptyName from Hget, got %s", rs.State)
+	}
+	if rs := db.Hscan("", nil, 0); rs.State != sharon.ErrEmptyName.Error() {
+		t.Errorf("expected ErrEmptyName from Hscan, got %s", rs.State)
+	}
+	if rs := db.Zscan("", nil, nil, 0); rs.State != sharon.ErrEmptyName.Error() {
+		t.Errorf("expected ErrEmptyName from Zscan, got %s", rs.State)
+	}
+
+	if err := db.Hset("named", []byte("k"), []byte("v")); err != nil {
+		t.Errorf("expected named buckets to work in strict mode, got %v", err)
+	}
+	if _, err := db.Incr([]byte("flat"), 1); err != nil {
+		t.Errorf("expected the flat keyspace to work in strict mode, got %v", err)
+	}
+}
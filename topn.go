@@ -0,0 +1,113 @@
+package sharon
+
+import (
+	"bytes"
+	"container/heap"
+	"slices"
+)
+
+// topN keeps the first limit entries by the order of before, using a heap whose root is
+// the kept entry that comes last, so memory stays O(limit). limit <= 0 keeps everything.
+type topN struct {
+	limit   int
+	before  func(a, b Entry) bool
+	entries []Entry
+}
+
+func (t *topN) Len() int           { return len(t.entries) }
+func (t *topN) Less(i, j int) bool { return t.before(t.entries[j], t.entries[i]) }
+func (t *topN) Swap(i, j int)      { t.entries[i], t.entries[j] = t.entries[j], t.entries[i] }
+func (t *topN) Push(x any)         { t.entries = append(t.entries, x.(Entry)) }
+func (t *topN) Pop() any {
+	e := t.entries[len(t.entries)-1]
+	t.entries = t.entries[:len(t.entries)-1]
+	return e
+}
+
+// offer considers key and val, they are copied only if kept.
+func (t *topN) offer(key, val []byte) {
+	e := Entry{key, val}
+	if t.limit > 0 && len(t.entries) == t.limit {
+		if !t.before(e, t.entries[0]) {
+			return
+		}
+		t.entries[0] = Entry{append([]byte{}, key...), append([]byte{}, val...)}
+		heap.Fix(t, 0)
+		return
+	}
+	heap.Push(t, Entry{append([]byte{}, key...), append([]byte{}, val...)})
+}
+
+// sorted returns the kept entries in order.
+func (t *topN) sorted() []Entry {
+	slices.SortFunc(t.entries, func(a, b Entry) int {
+		switch {
+		case t.before(a, b):
+			return -1
+		case t.before(b, a):
+			return 1
+		}
+		return 0
+	})
+	return t.entries
+}
+
+// HscanSortedByValue list the limit key-value pairs of a hashmap with the lowest values,
+// or the highest when desc, ordered by value compared bytewise (8-byte numbers compare numerically).
+// The whole hashmap is scanned but only limit entries are held in memory.
+func (db *DB) HscanSortedByValue(name string, limit int, desc bool) *Reply {
+	return db.hscanSortedBy(name, limit, desc, func(val []byte) ([]byte, bool) {
+		return val, true
+	})
+}
+
+// HscanByValuePrefix is like HscanSortedByValue but orders by the field of tsLen bytes at
+// tsOffset of each value, such as a big-endian timestamp heading it. Values too short to
+// hold the field are skipped. It is O(n) in the hashmap but O(limit) in memory.
+func (db *DB) HscanByValuePrefix(name string, tsOffset, tsLen int, limit int, desc bool) *Reply {
+	return db.hscanSortedBy(name, limit, desc, func(val []byte) ([]byte, bool) {
+		if tsOffset < 0 || tsLen < 0 || len(val) < tsOffset+tsLen {
+			return nil, false
+		}
+		return val[tsOffset : tsOffset+tsLen], true
+	})
+}
+
+// hscanSortedBy keeps the limit entries of a hashmap ordered by the bytes field extracts
+// from their values, entries it rejects are skipped.
+func (db *DB) hscanSortedBy(name string, limit int, desc bool, field func(val []byte) ([]byte, bool)) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	t := &topN{limit: limit, before: func(a, b Entry) bool {
+		fa, _ := field(a.Value)
+		fb, _ := field(b.Value)
+		c := bytes.Compare(fa, fb)
+		if c == 0 {
+			return bytes.Compare(a.Key, b.Key) < 0
+		}
+		return (c < 0) != desc
+	}}
+	err := db.hscanEach(name, nil, func(key, val []byte) bool {
+		if _, ok := field(val); ok {
+			t.offer(key, val)
+		}
+		return true
+	})
+	if err != nil {
+		r.State = err.Error()
+		return r
+	}
+	size := 0
+	for _, e := range t.sorted() {
+		r.Data = append(r.Data, e.Key, e.Value)
+		if db.replyFull(r, &size) {
+			return r
+		}
+	}
+	if len(r.Data) > 0 {
+		r.State = replyOK
+	}
+	return r
+}
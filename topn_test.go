@@ -0,0 +1,66 @@
+package sharon_test
+
+import (
+	"testing"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestHscanSortedByValue(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "scores"
+	values := map[string]uint64{"a": 50, "b": 10, "c": 90, "d": 30, "e": 70}
+	for k, v := range values {
+		_ = db.Hset(name, []byte(k), sharon.Uint64ToBytes(v))
+	}
+
+	list := db.HscanSortedByValue(name, 3, true).List()
+	want := []string{"c", "e", "a"}
+	if len(list) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(list))
+	}
+	for i, k := range want {
+		if list[i].Key.String() != k || list[i].Value.Uint64() != values[k] {
+			t.Errorf("position %d: expected %s=%d, got %s=%d", i, k, values[k], list[i].Key, list[i].Value.Uint64())
+		}
+	}
+
+	list = db.HscanSortedByValue(name, 2, false).List()
+	if len(list) != 2 || list[0].Key.String() != "b" || list[1].Key.String() != "d" {
+		t.Errorf("expected [b d], got %v", list)
+	}
+
+	if n := db.HscanSortedByValue(name, 0, false).KvLen(); n != 5 {
+		t.Errorf("expected all 5 entries without limit, got %d", n)
+	}
+}
+
+func TestHscanByValuePrefix(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "feed"
+	events := map[string]uint64{"login": 1700000300, "post": 1700000100, "like": 1700000500, "share": 1700000200}
+	for k, ts := range events {
+		_ = db.Hset(name, []byte(k), sharon.Bconcat(sharon.Uint64ToBytes(ts), []byte("payload:"+k)))
+	}
+	_ = db.Hset(name, []byte("broken"), []byte("short"))
+
+	list := db.HscanByValuePrefix(name, 0, 8, 3, true).List()
+	want := []string{"like", "login", "share"}
+	if len(list) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(list))
+	}
+	for i, k := range want {
+		if list[i].Key.String() != k || sharon.BytesToUint64(list[i].Value[:8]) != events[k] {
+			t.Errorf("position %d: expected %s, got %s", i, k, list[i].Key)
+		}
+	}
+
+	list = db.HscanByValuePrefix(name, 0, 8, 0, false).List()
+	if len(list) != 4 || list[0].Key.String() != "post" {
+		t.Errorf("expected 4 entries oldest first, got %v", list)
+	}
+}
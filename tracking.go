@@ -0,0 +1,121 @@
+package sharon
+
+import (
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// With bucket tracking, every write keeps the number of keys of every hashmap under
+// metaPrefix+"hcount"+splitChar+name and the number of non-empty hashmaps under
+// hnamesKey, by replaying its batch against the stored keys.
+
+var hnamesKey = Bconcat(metaPrefix, []byte("hnames"))
+
+// SetBucketTracking makes the hashmap writes track the number of non-empty hashmaps for
+// HnameCount. Each tracked write costs an existence check per hashmap key it writes and a
+// counter update, and tracked writes are serialized with each other. It must be set before
+// the DB is used concurrently, on a DB whose hashmaps were all written with tracking.
+func (db *DB) SetBucketTracking(enabled bool) {
+	db.bucketTracking = enabled
+}
+
+// HnameCount returns the number of non-empty hashmaps tracked since bucket tracking was enabled.
+func (db *DB) HnameCount() (int64, error) {
+	val, err := db.Get(hnamesKey, nil)
+	if err == errors.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(BytesToUint64(val)), nil
+}
+
+// trackBuckets stages the counter updates for the hashmap keys batch adds or removes into
+// batch. The returned unlock func must be called once batch is written.
+func (db *DB) trackBuckets(batch *leveldb.Batch) (unlock func(), err error) {
+	w := hashWrites{keys: map[string]bool{}, versions: map[string]bool{}}
+	if err = batch.Replay(&w); err != nil {
+		return nil, err
+	}
+	if len(w.keys) == 0 {
+		return func() {}, nil
+	}
+	db.trackMu.Lock()
+	if err = db.stageBucketCounts(batch, w.keys); err != nil {
+		db.trackMu.Unlock()
+		return nil, err
+	}
+	return db.trackMu.Unlock, nil
+}
+
+// stageBucketCounts stages the counter updates for putting, or deleting if false, the hashmap
+// keys of realKeys into batch. The caller must hold trackMu.
+func (db *DB) stageBucketCounts(batch *leveldb.Batch, realKeys map[string]bool) error {
+	steps := map[string]int64{}
+	for realKey, put := range realKeys {
+		has, err := db.Has([]byte(realKey), nil)
+		if err != nil {
+			return err
+		}
+		if has == put {
+			continue
+		}
+		name := realKey[len(hashPrefix):]
+		if i := strings.IndexByte(name, splitChar[0]); i >= 0 {
+			name = name[:i]
+		}
+		if put {
+			steps[name]++
+		} else {
+			steps[name]--
+		}
+	}
+
+	nameStep := int64(0)
+	for name, step := range steps {
+		countKey := Bconcat(metaPrefix, []byte("hcount"), splitChar, []byte(name))
+		var count uint64
+		if val, err := db.Get(countKey, nil); err == nil {
+			count = BytesToUint64(val)
+		} else if err != errors.ErrNotFound {
+			return err
+		}
+		newCount, err := incrBy(count, step)
+		if err != nil {
+			// keys written before tracking was enabled
+			newCount = 0
+		}
+		switch {
+		case newCount == count:
+			continue
+		case count == 0:
+			nameStep++
+		case newCount == 0:
+			nameStep--
+		}
+		if newCount == 0 {
+			batch.Delete(countKey)
+		} else {
+			batch.Put(countKey, Uint64ToBytes(newCount))
+		}
+	}
+	if nameStep == 0 {
+		return nil
+	}
+
+	var names uint64
+	if val, err := db.Get(hnamesKey, nil); err == nil {
+		names = BytesToUint64(val)
+	} else if err != errors.ErrNotFound {
+		return err
+	}
+	names, err := incrBy(names, nameStep)
+	if err != nil {
+		return err
+	}
+	batch.Put(hnamesKey, Uint64ToBytes(names))
+	return nil
+}
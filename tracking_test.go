@@ -0,0 +1,83 @@
+package sharon_test
+
+import (
+	"testing"
+)
+
+func TestHnameCount(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	db.SetBucketTracking(true)
+
+	count := func() int64 {
+		t.Helper()
+		n, err := db.HnameCount()
+		if err != nil {
+			t.Fatalf("HnameCount failed: %v", err)
+		}
+		return n
+	}
+	if n := count(); n != 0 {
+		t.Errorf("expected 0 hashmaps, got %d", n)
+	}
+
+	_ = db.Hset("a", []byte("k1"), []byte("v"))
+	_ = db.Hset("a", []byte("k1"), []byte("overwrite"))
+	_ = db.Hset("a", []byte("k2"), []byte("v"))
+	_ = db.Hset("b", []byte("k1"), []byte("v"))
+	_ = db.Hset("c", []byte("k1"), []byte("v"))
+	if n := count(); n != 3 {
+		t.Errorf("expected 3 hashmaps, got %d", n)
+	}
+
+	_ = db.Hdel("a", []byte("k1"))
+	_ = db.Hdel("a", []byte("missing"))
+	if n := count(); n != 3 {
+		t.Errorf("expected a to stay tracked with one key left, got %d", n)
+	}
+	_ = db.Hdel("a", []byte("k2"))
+	_ = db.Hdel("b", []byte("k1"))
+	_ = db.Hdel("b", []byte("k1"))
+	if n := count(); n != 1 {
+		t.Errorf("expected 1 hashmap after emptying a and b, got %d", n)
+	}
+
+	_ = db.Hset("a", []byte("again"), []byte("v"))
+	if n := count(); n != 2 {
+		t.Errorf("expected 2 hashmaps after refilling a, got %d", n)
+	}
+}
+
+func TestHnameCountAllWrites(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+	db.SetBucketTracking(true)
+
+	check := func(want int64) {
+		t.Helper()
+		if n, err := db.HnameCount(); err != nil || n != want {
+			t.Errorf("expected %d hashmaps, got %d %v", want, n, err)
+		}
+	}
+
+	_ = db.Hmset("a", []byte("k1"), []byte("v"), []byte("k2"), []byte("v"))
+	l := db.NewLoader(0)
+	_ = l.Hset("b", []byte("k1"), []byte("v"))
+	_ = l.Flush()
+	txn := db.Watch()
+	txn.Hset("c", []byte("k1"), []byte("v"))
+	if _, err := txn.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	check(3)
+
+	_ = db.Hmdel("a", [][]byte{[]byte("k1"), []byte("k2")})
+	check(2)
+	_ = db.HdelBucket("b")
+	check(1)
+	_ = db.Hset("c", []byte("k2"), []byte("v"))
+	_ = db.Hdel("c", []byte("k1"))
+	check(1)
+	_ = db.HdelBucket("c")
+	check(0)
+}
@@ -0,0 +1,188 @@
+package sharon
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The deadline of a key is stored as 8-byte big endian unix nanoseconds under ttlPrefix+realKey.
+// Expired keys are hidden from the point reads (Hget, Hmget, HgetInt, HhasKey, ...)
+// but not from scans, they are removed when overwritten or deleted.
+
+// Hexpire set the key of a hashmap to expire after ttl, the key must exist.
+func (db *DB) Hexpire(name string, key []byte, ttl time.Duration) error {
+	return db.HexpireAt(name, key, time.Now().Add(ttl))
+}
+
+// HexpireAt set the key of a hashmap to expire at deadline, the key must exist.
+func (db *DB) HexpireAt(name string, key []byte, deadline time.Time) error {
+	return db.expireAt(Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key), deadline)
+}
+
+// Hpersist remove the expiry of the key of a hashmap, the key must exist.
+func (db *DB) Hpersist(name string, key []byte) error {
+	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
+	has, err := db.hhas(realKey)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return errors.ErrNotFound
+	}
+	return db.delete(Bconcat(ttlPrefix, realKey))
+}
+
+// HexpiringWithin list the keys of a hashmap that expire within window, soonest first, paired
+// with their deadline as 8-byte unix nanoseconds. Keys already expired are left out.
+// The TTL meta of the hashmap is scanned but only limit keys are held in memory.
+func (db *DB) HexpiringWithin(name string, window time.Duration, limit int) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []BS{},
+	}
+	now := deadlineNano(time.Now())
+	horizon := deadlineNano(time.Now().Add(window))
+	t := &topN{limit: limit, before: func(a, b Entry) bool {
+		c := bytes.Compare(a.Value, b.Value)
+		if c == 0 {
+			return bytes.Compare(a.Key, b.Key) < 0
+		}
+		return c < 0
+	}}
+	prefix := Bconcat(ttlPrefix, hashPrefix, StringToBytesNoCopy(name), splitChar)
+	iter := db.newIterator(util.BytesPrefix(prefix), nil)
+	for iter.Next() {
+		deadline := BytesToUint64(iter.Value())
+		if deadline > now && deadline < horizon {
+			t.offer(iter.Key()[len(prefix):], iter.Value())
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		r.State = err.Error()
+		return r
+	}
+	size := 0
+	for _, e := range t.sorted() {
+		r.Data = append(r.Data, e.Key, e.Value)
+		if db.replyFull(r, &size) {
+			return r
+		}
+	}
+	if len(r.Data) > 0 {
+		r.State = replyOK
+	}
+	return r
+}
+
+// TTLEntry a key of a hashmap with its deadline, for diagnostics.
+type TTLEntry struct {
+	Key      BS
+	Deadline time.Time
+	// Expired is set for keys past their deadline, which are hidden but still stored.
+	Expired bool
+}
+
+// HttlList list the keys of a hashmap that have a deadline in key order, including
+// expired ones, by reading the TTL meta directly. Like HscanIntKeys and HscanNumeric, it
+// returns a nil list with the error of a failed read.
+func (db *DB) HttlList(name string, limit int) ([]TTLEntry, error) {
+	list := []TTLEntry{}
+	now := time.Now()
+	prefix := Bconcat(ttlPrefix, hashPrefix, StringToBytesNoCopy(name), splitChar)
+	iter := db.newIterator(util.BytesPrefix(prefix), nil)
+	for iter.Next() {
+		deadline := time.Unix(0, int64(BytesToUint64(iter.Value())))
+		list = append(list, TTLEntry{
+			Key:      append([]byte{}, iter.Key()[len(prefix):]...),
+			Deadline: deadline,
+			Expired:  !deadline.After(now),
+		})
+		if len(list) == limit {
+			break
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (db *DB) expireAt(realKey []byte, deadline time.Time) error {
+	has, err := db.hhas(realKey)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return errors.ErrNotFound
+	}
+	db.ttlUsed.Store(true)
+	return db.put(Bconcat(ttlPrefix, realKey), Uint64ToBytes(deadlineNano(deadline)))
+}
+
+// expired reports whether realKey has a deadline that passed.
+func (db *DB) expired(realKey []byte) (bool, error) {
+	if !db.ttlUsed.Load() {
+		return false, nil
+	}
+	val, err := db.Get(Bconcat(ttlPrefix, realKey), nil)
+	if err == errors.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return BytesToUint64(val) <= deadlineNano(time.Now()), nil
+}
+
+// hget get the decoded value of realKey, expired keys are not found.
+func (db *DB) hget(realKey []byte) ([]byte, error) {
+	return db.hgetWith(realKey, nil)
+}
+
+// hgetWith is like hget but reads the value with ro.
+func (db *DB) hgetWith(realKey []byte, ro *opt.ReadOptions) ([]byte, error) {
+	val, err := db.read(realKey, ro)
+	if err != nil {
+		return nil, err
+	}
+	expired, err := db.expired(realKey)
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, errors.ErrNotFound
+	}
+	return db.decodeValue(val)
+}
+
+// hhas reports whether realKey exists and is not expired.
+func (db *DB) hhas(realKey []byte) (bool, error) {
+	has, err := db.Has(realKey, nil)
+	if err != nil || !has {
+		return false, err
+	}
+	expired, err := db.expired(realKey)
+	return !expired, err
+}
+
+// clearTTL stages the removal of the deadline of realKey.
+func (db *DB) clearTTL(batch *leveldb.Batch, realKey []byte) {
+	if db.ttlUsed.Load() {
+		batch.Delete(Bconcat(ttlPrefix, realKey))
+	}
+}
+
+func deadlineNano(t time.Time) uint64 {
+	n := t.UnixNano()
+	if n < 0 {
+		return 0
+	}
+	return uint64(n)
+}
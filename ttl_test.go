@@ -0,0 +1,148 @@
+package sharon_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ehebe/sharon"
+)
+
+func TestHexpireAt(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "billing"
+	key := []byte("period")
+	if err := db.HexpireAt(name, key, time.Now().Add(time.Hour)); err == nil {
+		t.Errorf("expected error on missing key")
+	}
+
+	_ = db.Hset(name, key, []byte("open"))
+	if err := db.HexpireAt(name, key, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("HexpireAt failed: %v", err)
+	}
+	if rs := db.Hget(name, key); !rs.NotFound() {
+		t.Errorf("expected expired key to be not found, got %s", rs.State)
+	}
+	if db.HhasKey(name, key) {
+		t.Errorf("expected expired key to be absent")
+	}
+	if err := db.Hpersist(name, key); err == nil {
+		t.Errorf("expected Hpersist on expired key to fail")
+	}
+
+	// a fresh write must not inherit the old deadline
+	_ = db.Hset(name, key, []byte("reopened"))
+	if got := db.Hget(name, key).String(); got != "reopened" {
+		t.Errorf("expected reopened, got %q", got)
+	}
+}
+
+func TestHpersist(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "session"
+	key := []byte("token")
+	_ = db.Hset(name, key, []byte("abc"))
+	if err := db.Hexpire(name, key, 50*time.Millisecond); err != nil {
+		t.Fatalf("Hexpire failed: %v", err)
+	}
+	if err := db.Hpersist(name, key); err != nil {
+		t.Fatalf("Hpersist failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := db.Hget(name, key).String(); got != "abc" {
+		t.Errorf("expected persisted key to survive, got %q", got)
+	}
+	if err := db.Hpersist(name, []byte("missing")); err == nil {
+		t.Errorf("expected error on missing key")
+	}
+}
+
+func TestHexpiringWithin(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "warm"
+	ttls := map[string]time.Duration{
+		"a": 30 * time.Minute,
+		"b": 5 * time.Minute,
+		"c": 2 * time.Hour,
+		"d": 10 * time.Minute,
+		"e": -time.Second,
+	}
+	for k, ttl := range ttls {
+		_ = db.Hset(name, []byte(k), []byte("v"))
+		if err := db.Hexpire(name, []byte(k), ttl); err != nil {
+			t.Fatalf("Hexpire failed: %v", err)
+		}
+	}
+	_ = db.Hset(name, []byte("f"), []byte("forever"))
+	_ = db.Hset("other", []byte("g"), []byte("v"))
+	_ = db.Hexpire("other", []byte("g"), time.Minute)
+
+	var got []string
+	db.HexpiringWithin(name, time.Hour, 0).KvEach(func(key, _ sharon.BS) {
+		got = append(got, key.String())
+	})
+	if want := []string{"b", "d", "a"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if rs := db.HexpiringWithin(name, time.Hour, 2); rs.KvLen() != 2 || rs.Data[0].String() != "b" {
+		t.Errorf("expected the 2 soonest keys, got %v", rs.List())
+	}
+	if rs := db.HexpiringWithin(name, time.Minute, 0); rs.OK() {
+		t.Errorf("expected nothing expiring within a minute, got %v", rs.List())
+	}
+
+	db.SetMaxReplyBytes(20)
+	if rs := db.HexpiringWithin(name, time.Hour, 0); rs.OK() || rs.KvLen() != 2 {
+		t.Errorf("expected the cap to keep the 2 soonest keys, got %d (%s)", rs.KvLen(), rs.State)
+	}
+}
+
+func TestHttlList(t *testing.T) {
+	db := setupDB(t)
+
+	name := "inspect"
+	base := time.Now().Truncate(time.Second)
+	deadlines := map[string]time.Time{
+		"a": base.Add(time.Hour),
+		"b": base.Add(-time.Minute),
+		"c": base.Add(24 * time.Hour),
+	}
+	for k, d := range deadlines {
+		_ = db.Hset(name, []byte(k), []byte("v"))
+		if err := db.HexpireAt(name, []byte(k), d); err != nil {
+			t.Fatalf("HexpireAt failed: %v", err)
+		}
+	}
+	_ = db.Hset(name, []byte("d"), []byte("forever"))
+
+	list, err := db.HttlList(name, 0)
+	if err != nil {
+		t.Fatalf("HttlList failed: %v", err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(list))
+	}
+	for i, k := range []string{"a", "b", "c"} {
+		e := list[i]
+		if e.Key.String() != k || !e.Deadline.Equal(deadlines[k]) {
+			t.Errorf("expected %s at %v, got %s at %v", k, deadlines[k], e.Key, e.Deadline)
+		}
+		if e.Expired != (k == "b") {
+			t.Errorf("%s: unexpected expired flag %v", k, e.Expired)
+		}
+	}
+	if list, _ = db.HttlList(name, 2); len(list) != 2 {
+		t.Errorf("expected limit of 2, got %d", len(list))
+	}
+
+	_ = db.Close()
+	if _, err = db.HttlList(name, 0); err == nil {
+		t.Errorf("expected error on a closed DB")
+	}
+}
@@ -0,0 +1,125 @@
+package sharon
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// Txn stages writes that Exec commits only if none of the watched keys changed since
+// Watch, like Redis WATCH/MULTI/EXEC. Exec checks and commits while every other write
+// of the DB is held off, so no write can land between the check and the commit.
+// A Txn is not safe for concurrent use.
+type Txn struct {
+	db      *DB
+	watched [][]byte
+	values  [][]byte
+	err     error
+	ops     []func(batch *leveldb.Batch) error
+}
+
+// Watch starts a transaction watching the raw leveldb keys realKeys.
+func (db *DB) Watch(realKeys ...[]byte) *Txn {
+	t := &Txn{db: db}
+	for _, realKey := range realKeys {
+		val, err := db.getRaw(realKey)
+		if err != nil {
+			t.err = err
+		}
+		t.watched = append(t.watched, append([]byte{}, realKey...))
+		t.values = append(t.values, val)
+	}
+	return t
+}
+
+// getRaw returns the raw value stored at realKey, nil if it does not exist.
+func (db *DB) getRaw(realKey []byte) ([]byte, error) {
+	val, err := db.Get(realKey, nil)
+	if err == errors.ErrNotFound {
+		return nil, nil
+	}
+	if err == nil && val == nil {
+		val = []byte{}
+	}
+	return val, err
+}
+
+// Hset stages setting the value of the key of a hashmap.
+func (t *Txn) Hset(name string, key, val []byte) {
+	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
+	val = append([]byte{}, t.db.encodeValue(val)...)
+	t.ops = append(t.ops, func(batch *leveldb.Batch) error {
+		batch.Put(realKey, val)
+		t.db.clearTTL(batch, realKey)
+		return nil
+	})
+}
+
+// Hdel stages deleting the key of a hashmap.
+func (t *Txn) Hdel(name string, key []byte) {
+	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
+	t.ops = append(t.ops, func(batch *leveldb.Batch) error {
+		batch.Delete(realKey)
+		t.db.clearTTL(batch, realKey)
+		return nil
+	})
+}
+
+// Zset stages setting the score of the key of a zset, the previous score is read at Exec.
+// A zset member should be staged at most once per transaction.
+func (t *Txn) Zset(name string, key []byte, val uint64) {
+	nameB := []byte(name)
+	key = append([]byte{}, key...)
+	t.ops = append(t.ops, func(batch *leveldb.Batch) error {
+		_, err := t.db.stageZset(batch, nameB, key, Uint64ToBytes(val))
+		return err
+	})
+}
+
+// Zdel stages deleting the key of a zset, the current score is read at Exec.
+func (t *Txn) Zdel(name string, key []byte) {
+	nameB := []byte(name)
+	key = append([]byte{}, key...)
+	t.ops = append(t.ops, func(batch *leveldb.Batch) error {
+		score, err := t.db.getRaw(Bconcat(zetScorePrefix, nameB, splitChar, key))
+		if err != nil || score == nil {
+			return err
+		}
+		return t.db.stageZdel(batch, nameB, key, score)
+	})
+}
+
+// Exec commits the staged writes in a single batch and returns true, or returns false
+// without writing anything if a watched key was changed or deleted since Watch.
+func (t *Txn) Exec() (bool, error) {
+	if t.err != nil {
+		return false, t.err
+	}
+
+	batch := new(leveldb.Batch)
+	for _, op := range t.ops {
+		if err := op(batch); err != nil {
+			return false, err
+		}
+	}
+	err := t.db.writeIf(batch, func() error {
+		for i, realKey := range t.watched {
+			val, err := t.db.getRaw(realKey)
+			if err != nil {
+				return err
+			}
+			if (val == nil) != (t.values[i] == nil) || !bytes.Equal(val, t.values[i]) {
+				return errWatchChanged
+			}
+		}
+		return nil
+	})
+	if err == errWatchChanged {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// errWatchChanged aborts the write of Exec when a watched key changed.
+var errWatchChanged = errors.New("watched key changed")
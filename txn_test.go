@@ -0,0 +1,103 @@
+package sharon_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ehebe/sharon"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestTxnExec(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	balance := sharon.Bconcat([]byte{30}, []byte("accounts"), []byte{28}, []byte("alice"))
+	_ = db.Hset("accounts", []byte("alice"), sharon.Uint64ToBytes(100))
+
+	txn := db.Watch(balance)
+	txn.Hset("accounts", []byte("alice"), sharon.Uint64ToBytes(70))
+	txn.Zset("ledger", []byte("alice"), 70)
+	ok, err := txn.Exec()
+	if err != nil || !ok {
+		t.Fatalf("expected unchanged watch to commit, got %v (%v)", ok, err)
+	}
+	if got := db.Hget("accounts", []byte("alice")).Uint64(); got != 70 {
+		t.Errorf("expected 70, got %d", got)
+	}
+	if got := db.Zget("ledger", []byte("alice")); got != 70 {
+		t.Errorf("expected ledger score 70, got %d", got)
+	}
+
+	txn = db.Watch(balance)
+	txn.Hset("accounts", []byte("alice"), sharon.Uint64ToBytes(40))
+	txn.Zdel("ledger", []byte("alice"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = db.Hset("accounts", []byte("alice"), sharon.Uint64ToBytes(500))
+	}()
+	<-done
+
+	if ok, err = txn.Exec(); err != nil || ok {
+		t.Fatalf("expected concurrent write to abort, got %v (%v)", ok, err)
+	}
+	if got := db.Hget("accounts", []byte("alice")).Uint64(); got != 500 {
+		t.Errorf("expected aborted txn to leave 500, got %d", got)
+	}
+	if got := db.Zget("ledger", []byte("alice")); got != 70 {
+		t.Errorf("expected aborted txn to keep ledger score 70, got %d", got)
+	}
+
+	missing := sharon.Bconcat([]byte{30}, []byte("accounts"), []byte{28}, []byte("bob"))
+	txn = db.Watch(missing)
+	txn.Hset("accounts", []byte("bob"), sharon.Uint64ToBytes(1))
+	_ = db.Hset("accounts", []byte("bob"), []byte{})
+	if ok, _ = txn.Exec(); ok {
+		t.Errorf("expected creating a watched missing key to abort")
+	}
+}
+
+func TestTxnExecHoldsOffWrites(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	counter := sharon.Bconcat([]byte{30}, []byte("stats"), []byte{28}, []byte("hits"))
+	_ = db.Hset("stats", []byte("hits"), sharon.Uint64ToBytes(1))
+
+	// a plain write racing the commit of the transaction must not land between its check
+	// and its commit, where the commit would silently overwrite it
+	var landedEarly atomic.Bool
+	db.SetWriteFunc(func(batch *leveldb.Batch) error {
+		db.SetWriteFunc(nil)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_ = db.Hset("stats", []byte("hits"), sharon.Uint64ToBytes(100))
+		}()
+		select {
+		case <-done:
+			landedEarly.Store(true)
+		case <-time.After(50 * time.Millisecond):
+		}
+		return db.Write(batch, nil)
+	})
+
+	txn := db.Watch(counter)
+	txn.Hset("stats", []byte("hits"), sharon.Uint64ToBytes(2))
+	if ok, err := txn.Exec(); err != nil || !ok {
+		t.Fatalf("expected the txn to commit, got %v (%v)", ok, err)
+	}
+	if landedEarly.Load() {
+		t.Errorf("expected the plain write to wait for the commit")
+	}
+	deadline := time.Now().Add(time.Second)
+	for db.Hget("stats", []byte("hits")).Uint64() != 100 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := db.Hget("stats", []byte("hits")).Uint64(); got != 100 {
+		t.Errorf("expected the plain write to land after the commit, got %d", got)
+	}
+}
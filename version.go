@@ -0,0 +1,129 @@
+package sharon
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The version of a hashmap key is kept under metaPrefix+"hver"+realKey, written in the same
+// batch as the value. From the first HsetVersioned on, every write putting or deleting a
+// hashmap key bumps its version at the cost of a read. The version of a deleted key stays
+// behind as a tombstone, so versions never repeat and a writer holding the version read
+// before a delete cannot overwrite the recreated key.
+
+// ErrVersionMismatch is returned by HsetVersioned when the stored version differs from the expected one.
+var ErrVersionMismatch = errors.New("version mismatch")
+
+var hverPrefix = Bconcat(metaPrefix, []byte("hver"))
+
+// HsetVersioned set the value of the key of a hashmap if its version is expectedVersion, 0 for
+// a key never written since versions are in use, and returns the incremented version. It
+// returns ErrVersionMismatch without writing otherwise.
+func (db *DB) HsetVersioned(name string, key, val []byte, expectedVersion uint64) (newVersion uint64, err error) {
+	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
+	versionKey := hverKey(realKey)
+	db.versionUsed.Store(true)
+	defer lockStriped(&db.versionLocks, [][]byte{versionKey})()
+
+	version, err := db.version(versionKey)
+	if err != nil {
+		return 0, err
+	}
+	if version != expectedVersion {
+		return 0, ErrVersionMismatch
+	}
+	batch := new(leveldb.Batch)
+	batch.Put(realKey, db.encodeValue(val))
+	db.clearTTL(batch, realKey)
+	batch.Put(versionKey, Uint64ToBytes(version+1))
+	if err = db.write(batch); err != nil {
+		return 0, err
+	}
+	return version + 1, nil
+}
+
+// HgetVersioned get the value of the key of a hashmap with its version, see HsetVersioned.
+// For a missing key it returns ErrNotFound with the version to expect when creating it.
+func (db *DB) HgetVersioned(name string, key []byte) (val []byte, version uint64, err error) {
+	realKey := Bconcat(hashPrefix, StringToBytesNoCopy(name), splitChar, key)
+	val, getErr := db.hget(realKey)
+	if getErr != nil && getErr != errors.ErrNotFound {
+		return nil, 0, getErr
+	}
+	if version, err = db.version(hverKey(realKey)); err != nil {
+		return nil, 0, err
+	}
+	return val, version, getErr
+}
+
+func hverKey(realKey []byte) []byte {
+	return Bconcat(hverPrefix, realKey)
+}
+
+func (db *DB) version(versionKey []byte) (uint64, error) {
+	val, err := db.Get(versionKey, nil)
+	if err == errors.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return BytesToUint64(val), nil
+}
+
+// hasVersions reports whether any hashmap key has a version.
+func (db *DB) hasVersions() bool {
+	iter := db.DB.NewIterator(util.BytesPrefix(hverPrefix), nil)
+	defer iter.Release()
+	return iter.First()
+}
+
+// hashWrites collects the hashmap keys a batch writes, true for the ones it puts last,
+// and the version keys it writes.
+type hashWrites struct {
+	keys     map[string]bool
+	versions map[string]bool
+}
+
+func (w *hashWrites) write(key []byte, put bool) {
+	if len(key) > 0 && key[0] == hashPrefix[0] {
+		w.keys[string(key)] = put
+	} else if bytes.HasPrefix(key, hverPrefix) {
+		w.versions[string(key[len(hverPrefix):])] = true
+	}
+}
+
+func (w *hashWrites) Put(key, _ []byte) { w.write(key, true) }
+func (w *hashWrites) Delete(key []byte) { w.write(key, false) }
+
+// stageVersions stages bumping the version of every hashmap key batch puts or deletes,
+// unless batch writes that version itself, and locks them until the returned unlock is called. Batches writing a version come from callers
+// already holding its lock.
+func (db *DB) stageVersions(batch *leveldb.Batch) (unlock func(), err error) {
+	w := hashWrites{keys: map[string]bool{}, versions: map[string]bool{}}
+	if err = batch.Replay(&w); err != nil {
+		return nil, err
+	}
+	var versionKeys [][]byte
+	for realKey := range w.keys {
+		if !w.versions[realKey] {
+			versionKeys = append(versionKeys, hverKey([]byte(realKey)))
+		}
+	}
+	if len(versionKeys) == 0 {
+		return func() {}, nil
+	}
+	unlock = lockStriped(&db.versionLocks, versionKeys)
+	for _, versionKey := range versionKeys {
+		version, err := db.version(versionKey)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		batch.Put(versionKey, Uint64ToBytes(version+1))
+	}
+	return unlock, nil
+}
@@ -0,0 +1,94 @@
+package sharon_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ehebe/sharon"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestHsetVersioned(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "docs"
+	key := []byte("readme")
+	v1, err := db.HsetVersioned(name, key, []byte("draft"), 0)
+	if err != nil || v1 != 1 {
+		t.Fatalf("expected version 1, got %d %v", v1, err)
+	}
+	v2, err := db.HsetVersioned(name, key, []byte("final"), v1)
+	if err != nil || v2 != 2 {
+		t.Fatalf("expected version 2, got %d %v", v2, err)
+	}
+
+	// a writer holding the first version is rejected
+	if _, err = db.HsetVersioned(name, key, []byte("stale"), v1); !errors.Is(err, sharon.ErrVersionMismatch) {
+		t.Errorf("expected ErrVersionMismatch, got %v", err)
+	}
+	val, version, err := db.HgetVersioned(name, key)
+	if err != nil {
+		t.Fatalf("HgetVersioned failed: %v", err)
+	}
+	if string(val) != "final" || version != 2 {
+		t.Errorf("expected final at version 2, got %q at %d", val, version)
+	}
+	if got := db.Hget(name, key).String(); got != "final" {
+		t.Errorf("expected Hget to see the plain value, got %q", got)
+	}
+
+	if _, _, err = db.HgetVersioned(name, []byte("missing")); err == nil {
+		t.Errorf("expected error on missing key")
+	}
+}
+
+func TestVersionPlainWrites(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	name := "docs"
+	key := []byte("notes")
+	v1, _ := db.HsetVersioned(name, key, []byte("a"), 0)
+
+	// a plain write moves the version on, the first writer is now stale
+	_ = db.Hset(name, key, []byte("b"))
+	if _, err := db.HsetVersioned(name, key, []byte("c"), v1); !errors.Is(err, sharon.ErrVersionMismatch) {
+		t.Errorf("expected ErrVersionMismatch after a plain Hset, got %v", err)
+	}
+	_ = db.Hmset(name, key, []byte("d"))
+	if _, version, _ := db.HgetVersioned(name, key); version != v1+2 {
+		t.Errorf("expected version %d after two plain writes, got %d", v1+2, version)
+	}
+
+	// versions keep growing across a delete, a writer holding one from before is stale
+	_, stale, _ := db.HgetVersioned(name, key)
+	_ = db.Hdel(name, key)
+	_, tombstone, err := db.HgetVersioned(name, key)
+	if !errors.Is(err, leveldb.ErrNotFound) || tombstone != stale+1 {
+		t.Errorf("expected ErrNotFound at version %d after Hdel, got %d %v", stale+1, tombstone, err)
+	}
+	_ = db.Hset(name, key, []byte("e"))
+	if _, err = db.HsetVersioned(name, key, []byte("stale"), stale); !errors.Is(err, sharon.ErrVersionMismatch) {
+		t.Errorf("expected ErrVersionMismatch for a version from before the delete, got %v", err)
+	}
+	_, current, _ := db.HgetVersioned(name, key)
+	_ = db.HdelBucket(name)
+	if v, err := db.HsetVersioned(name, key, []byte("f"), current+1); err != nil || v != current+2 {
+		t.Errorf("expected version %d after HdelBucket, got %d %v", current+2, v, err)
+	}
+}
+
+func TestVersionReadOnly(t *testing.T) {
+	db := setupDB(t)
+	defer db.Close()
+
+	// reading versions does not make plain writes maintain them
+	name := "docs"
+	_ = db.Hset(name, []byte("k"), []byte("v"))
+	_, _, _ = db.HgetVersioned(name, []byte("k"))
+	_ = db.Hset(name, []byte("k"), []byte("w"))
+	if _, version, _ := db.HgetVersioned(name, []byte("k")); version != 0 {
+		t.Errorf("expected no version before the first HsetVersioned, got %d", version)
+	}
+}